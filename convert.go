@@ -0,0 +1,230 @@
+// lpc: Leaky Prefix Checker
+// Copyright (C) 2019  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+	"github.com/mys721tx/lpc/pkg/rpz"
+)
+
+// formatRPZ is the format of a response policy zone, read and written whole
+// rather than a line at a time.
+const formatRPZ = "rpz"
+
+// convert converts a block list between formats. It returns the exit status.
+func convert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+
+	var (
+		from, to    string
+		rpzNS       string
+		rpzAction   string
+		rpzWildcard bool
+	)
+
+	fs.StringVar(
+		&pin,
+		"in",
+		"",
+		"path to the block list, default to stdin.",
+	)
+
+	fs.StringVar(
+		&pout,
+		"out",
+		"",
+		"path to the output file, default to stdout.",
+	)
+
+	fs.StringVar(
+		&from,
+		"from",
+		"hosts",
+		"format of the input, default to hosts",
+	)
+
+	fs.StringVar(
+		&to,
+		"to",
+		"hosts",
+		"format of the output, default to hosts",
+	)
+
+	fs.StringVar(
+		&tgt,
+		"tgt",
+		"0.0.0.0",
+		"target IP address of the names without one, default to 0.0.0.0",
+	)
+
+	rpzFlag(fs)
+
+	fs.StringVar(
+		&rpzNS,
+		"rpz-ns",
+		"localhost",
+		"name server of the response policy zone written, default to localhost",
+	)
+
+	fs.StringVar(
+		&rpzAction,
+		"rpz-action",
+		rpz.NXDomain,
+		"action of the blocked names, nxdomain, nodata, drop, tcp-only or local, default to nxdomain",
+	)
+
+	fs.BoolVar(
+		&rpzWildcard,
+		"rpz-wildcard",
+		false,
+		"also block the subdomains of each name in the response policy zone, default to false",
+	)
+
+	fs.Parse(args)
+
+	var serial uint32
+
+	// The serial follows the one of the zone replaced.
+	if to == formatRPZ && pout != "" {
+		prev, err := rpz.ReadSerial(pout)
+
+		if err != nil {
+			log.Panicf("failed to read %q: %v", pout, err)
+		}
+
+		serial = rpz.NextSerial(prev, time.Now())
+	} else {
+		serial = rpz.NextSerial(0, time.Now())
+	}
+
+	fin := openIn(pin)
+	fout := openOut(pout)
+
+	defer func() {
+		if err := fin.Close(); err != nil {
+			log.Panicf("failed to close %q: %v", pin, err)
+		}
+	}()
+
+	defer func() {
+		if err := fout.Close(); err != nil {
+			log.Panicf("failed to close %q: %v", pout, err)
+		}
+	}()
+
+	in, ok := hosts.Formats[from]
+
+	if !ok && from != formatRPZ {
+		log.Panicf("unknown format %q", from)
+	}
+
+	out, ok := hosts.Formats[to]
+
+	if !ok && to != formatRPZ {
+		log.Panicf("unknown format %q", to)
+	}
+
+	w := bufio.NewWriter(fout)
+
+	defer func() {
+		if err := w.Flush(); err != nil {
+			log.Panicf("failed to flush %q: %v", pout, err)
+		}
+	}()
+
+	write := func(l *hosts.Line) {
+		for _, s := range out.Format(l, tgt) {
+			fmt.Fprintln(w, s)
+		}
+	}
+
+	if to == formatRPZ {
+		zw := rpz.NewWriter(w, rpzOrigin)
+		zw.NS = rpzNS
+		zw.Serial = serial
+		zw.Action = rpzAction
+		zw.Wildcard = rpzWildcard
+
+		write = func(l *hosts.Line) {
+			if err := zw.Write(l, tgt); err != nil {
+				log.Panicf("failed to write %q: %v", pout, err)
+			}
+		}
+
+		defer func() {
+			if err := zw.Close(); err != nil {
+				log.Panicf("failed to write %q: %v", pout, err)
+			}
+		}()
+	}
+
+	skipped, unit := 0, "lines"
+
+	if from == formatRPZ {
+		z, err := rpz.Parse(fin, rpzOrigin, pin)
+
+		if err != nil {
+			log.Panicf("failed to read %q: %v", pin, err)
+		}
+
+		for _, l := range z.Lines() {
+			write(l)
+		}
+
+		skipped, unit = z.Skipped, "records"
+	} else {
+		scn := bufio.NewScanner(fin)
+
+		for scn.Scan() {
+			l, err := in.Parse(scn.Text())
+
+			if err != nil {
+				skipped++
+				continue
+			}
+
+			if l != nil {
+				write(l)
+			}
+		}
+
+		if err := scn.Err(); err != nil {
+			log.Panicf("failed to read %q: %v", pin, err)
+		}
+	}
+
+	if skipped > 0 {
+		fmt.Fprintln(
+			os.Stderr,
+			"skipped",
+			skipped,
+			unit,
+			"not in the",
+			from,
+			"format",
+		)
+	}
+
+	return 0
+}
@@ -23,29 +23,367 @@ list through `www.` prefix.
 Usage:
 
 	lpc [flags]
+	lpc verify [flags]
+	lpc plan [flags]
+	lpc convert [flags]
 
 The flags are:
 
+	-authoritative
+		query the authoritative nameservers of each zone directly, default
+		to false
+	-backup string
+		suffix of the copy of the input file kept with -inplace, default
+		to none
+	-bufsize uint
+		EDNS0 UDP buffer size, 0 to disable EDNS0, default to 1232
+	-cache string
+		path to the answer cache file, default to none
+	-cache-max-age int64
+		maximum age of the cached answers used in seconds, 0 for no limit,
+		default to 0
+	-cache-only
+		answer only from the cache, even after the TTL expired, default to
+		false
+	-cache-refresh
+		query every name again and update the cache, default to false
+	-cookie
+		send DNS cookies, default to false
+	-canary string
+		name queried to detect a filtering resolver, empty to disable,
+		default to ad.doubleclick.net
+	-dnssec
+		request DNSSEC records and annotate the DNSSEC status of the added
+		entries, default to false
 	-dns string
-		IP address of the resolver, default to 8.8.8.8.",
+		comma separated IP addresses of the resolvers, system or
+		iterative, default to system.
+	-ecs string
+		client subnet sent in the EDNS0 Client Subnet option, default to
+		none
+	-from string
+		format of the input, hosts or rpz, default to hosts
+	-interface string
+		network interface whose addresses the queries are sent from,
+		default to any
+	-history string
+		path to the history of the dead entries, default to none
+	-import string
+		comma separated massdns or zdns outputs to answer from instead of
+		the resolvers, default to none
 	-in string
 		path to the hosts file, default to stdin.
+	-inplace
+		replace the input file atomically with the output, default to
+		false
+	-pool
+		reuse connections to the resolvers between queries, default to
+		true
+	-policy string
+		policy for multiple resolvers, failover, round-robin or consensus,
+		default to failover
 	-port string
-		port of the resolver, default to 53
+		port of the resolvers without one, default to 53
 	-prefix string
 		prefix to check for each hosts entry, default to www.
+	-prune string
+		comment or remove the dead entries, default to none
+	-prune-after int
+		number of consecutive runs an entry is dead before it is pruned,
+		default to 1
+	-quorum int
+		number of resolvers returning data for a consensus, default to a
+		majority
+	-record string
+		path to write every query and response of the run to, default to
+		none
+	-report string
+		path to the report of every checked name, default to none
+	-report-format string
+		format of the report, json, ndjson, csv, markdown or html, default
+		to json
+	-replay string
+		path to a capture written by -record to answer the queries from,
+		default to none
+	-rpz-origin string
+		origin of the response policy zone, default to rpz.local
+	-resolv-conf string
+		path to the system resolver configuration, default to
+		/etc/resolv.conf
+	-managed
+		write the added entries in the managed section, replaced on each
+		run, default to false
 	-out string
 		path to the output file, default to stdout.
+	-output-mode string
+		lines written, full, added, changed or diff, default to full
+	-source-addr string
+		comma separated local addresses of the queries, one per family,
+		default to any
+	-sinkhole string
+		comma separated addresses and CIDR blocks of filtered answers,
+		default to 0.0.0.0/32,127.0.0.0/8,::/128,::1/128
+	-trust-anchor string
+		path to the DS or DNSKEY trust anchors to validate locally, implies
+		-dnssec
 	-timeout int64
 		timeout for each DNS query, default to 10s
 	-tgt string
 		target IP address of the blocked entry, default to 0.0.0.0
 	-sleep int64
 		time between DNS query, default to 100ms
+	-wildcard
+		query a name under each leaking entry to annotate the wildcards,
+		default to false
+	-zone string
+		comma separated zone files to answer from instead of the
+		resolvers, each a path or origin=path, default to none
+
+The system resolvers are those listed in the resolver configuration. Its
+timeout, attempts and rotate options apply unless -timeout or -policy is given.
+Search domains and ndots are ignored as every query is fully qualified. Use
+-dns 8.8.8.8 to query Google Public DNS instead.
+
+With -dns iterative, no resolver is used. Each name is resolved from the root
+servers by following referrals, resolving nameservers without glue and
+restarting at CNAME targets. Delegations and answers are cached for the run,
+and the queries and cache hits are written to stderr at the end of the run.
+-port applies to every nameserver.
+
+A resolver such as Pi-hole answers blocked names with a sinkhole address
+instead of NXDOMAIN. A prefixed name answered only with sinkhole addresses is
+filtered rather than leaking, and is not added. Add the address of a block page
+to -sinkhole if the resolver answers with one. The canary name is queried on
+each resolver at startup to warn about a filtering resolver, one answering it
+with a sinkhole address or with NXDOMAIN as the name exists.
+
+Recursive resolvers cache negative answers and may filter. With
+-authoritative, the nameservers of the zone of each name are looked up from
+the resolvers and queried directly without recursion. The nameservers of each
+zone are cached, and the resolvers answer if the nameservers fail.
+
+With -dnssec, queries set the DO bit and each added entry is annotated as
+secure or insecure from the AD bit of a validating resolver. With
+-trust-anchor, validation is disabled on the resolvers and signatures are
+validated locally up to the anchors, such as the root.key file of Unbound. A
+prefixed name with a bogus answer is not added. The status of every checked
+name with an answer, entries and denials included, is written in the report.
+
+Some names resolve differently depending on the location of the client. With
+-ecs, queries carry the given client subnet and each added entry is annotated
+with the scope returned by the resolver, so runs from different subnets can be
+compared. With -cookie, queries carry DNS cookies, and a BADCOOKIE response is
+retried once with the new server cookie.
+
+The output file must not be the input file, which would be truncated before it
+is read. With -inplace, the output is written to a temporary file next to the
+input file, synced and renamed over it only if the run completes, keeping its
+permissions and owner, so an interrupted run leaves the input file as it was. A
+symbolic link is kept and the file it points to is replaced. Another owner is
+kept only if lpc runs as the superuser, and its group if the user is in it.
+With -backup .bak, the input file is kept as hosts.bak. -inplace writes the
+whole file, so it requires -output-mode full.
+
+By default the whole hosts file is written with the added entries. With
+-output-mode added, only the added prefixed entries are written, and with
+-output-mode changed, the entries annotated with an rcode as well. With
+-output-mode diff, a unified diff from the hosts file to the output is written
+instead, to apply with patch or paste into a pull request:
+
+	lpc -in hosts -output-mode diff > hosts.diff
+	patch hosts < hosts.diff
+
+With -managed, the added entries are written in a section at the end of the
+output between the lines "# BEGIN lpc" and "# END lpc". The section of the
+input is dropped without being queried and replaced wholesale, and the other
+lines are written as they are, so running lpc on its own output gives the same
+file. A section not ended is kept as is and no entries are added.
+
+Entries that do not exist are annotated with NXDOMAIN. With -prune comment,
+they are commented out instead, and with -prune remove, they are removed. The
+number of entries pruned is written to stderr. A name may be missing for a
+while, so with -prune-after 3, an entry is pruned only once it did not exist on
+3 consecutive runs, counted in the -history file. An entry answered with data
+starts over, and an error leaves the count unchanged. With -managed, a line is
+pruned only if every entry on it is. With a filtering resolver, an entry may be
+blocked rather than dead, so nothing is pruned or counted.
+
+With -report, a record of every checked name is written for dashboards and
+other tools: the name, the line of the hosts file and the entry it comes from,
+the prefix, the query types, the rcode, the answers, the CNAME chain, the
+classification, the resolver and transport, the round trip time and the time
+taken in milliseconds, the DNSSEC status, the client subnet scope, whether it
+was added, whether it is a wildcard and the error. The json format is an array
+of the records, and the ndjson format is a record on each line, written as the
+names are checked. The csv format is a row of each record after a header, with
+the answers and the CNAME chain separated by spaces, for spreadsheets.
+
+The markdown format is a summary to paste into a pull request: the number of
+names of each classification, the registrable domains with the most leaks from
+the public suffix list, the entries that do not exist and the names that
+failed.
+
+The html format is a single page without external assets for audits, with
+tables of the new leaks, the dead entries, the wildcard zones, the errors and
+every name, each sortable by clicking a column and filtered by classification
+and registrable domain, and the source lines linked from each name.
+
+With -from rpz, the input is a response policy zone as loaded by BIND or Knot
+instead of a hosts file, and is audited the same way. The zone is read as a
+hosts file with an entry for each name it blocks, so the output is a hosts
+file, with the comment and blank lines of the zone. The origin comes from the
+SOA record, or -rpz-origin for a file without one. A prefixed name under a
+*.name rule or exempted by a passthru rule is not queried. Rules other than
+QNAME triggers, such as rpz-ip, and CNAME rewrites are skipped and counted on
+stderr. -inplace, -managed and -output-mode diff require a hosts file. The run
+does not write a zone: the leaks it adds are converted to rules with the
+convert command, as shown below.
+
+A name under a wildcard leaks whatever the prefix. With -wildcard, the name
+lpc-wildcard-check is queried under each entry whose prefixed name leaks, and
+the added entry is annotated as a wildcard if it resolves.
+
+The verify command checks a list pushed to a filtering resolver. Every entry of
+the hosts file and its prefixed name is queried, and those not answered with a
+sinkhole address are written to stdout. The exit status is 1 if any name is not
+enforced. It accepts the flags above except -out, -inplace, -backup,
+-output-mode, -prune, -prune-after, -history, -managed, -tgt, -canary,
+-authoritative, -dnssec, -trust-anchor, -report, -report-format, -wildcard,
+-from and -rpz-origin, and:
+
+	-nxdomain
+		treat NXDOMAIN as enforced, default to false
+
+Each name is queried once. Special names are never queried: addresses, single
+labels such as localhost, and names under the special-use domains localhost,
+local, invalid, test, onion, alt and home.arpa.
+
+The plan command writes the queries a run would send without sending them, as
+the name, the type and the entry it is derived from, separated by tabs. The
+counts of queries and skipped names and the estimated runtime at the -sleep
+rate are written to stderr. It accepts the flags above except -inplace,
+-backup, -output-mode, -prune, -prune-after, -history, -managed, -tgt, -canary,
+-authoritative, -dnssec, -trust-anchor, -report, -report-format, -wildcard,
+-from and -rpz-origin.
+
+The convert command converts a block list between formats without sending any
+query:
+
+	-from string
+		format of the input, default to hosts
+	-in string
+		path to the block list, default to stdin.
+	-out string
+		path to the output file, default to stdout.
+	-rpz-action string
+		action of the blocked names, nxdomain, nodata, drop, tcp-only or
+		local, default to nxdomain
+	-rpz-ns string
+		name server of the response policy zone written, default to
+		localhost
+	-rpz-origin string
+		origin of the response policy zone, default to rpz.local
+	-rpz-wildcard
+		also block the subdomains of each name in the response policy
+		zone, default to false
+	-tgt string
+		target IP address of the names without one, default to 0.0.0.0
+	-to string
+		format of the output, default to hosts
+
+The formats are hosts, domains with a name on each line, dnsmasq with
+address=/name/address lines, dnsmasq-server with server=/name/ lines, unbound
+with local-data lines, adblock with ||name^ rules, and rpz for a response
+policy zone. Comments and blank lines are kept, on a line of their own in the
+formats without trailing comments. Lines of the input that are not blocked
+names, such as other options or AdBlock exception rules, are skipped and
+counted on stderr. The dnsmasq and AdBlock rules also block the subdomains of
+each name, unlike a hosts file.
+
+A response policy zone is written with a SOA record, whose serial is the date
+as YYYYMMDDnn and follows the serial of the -out file it replaces, and an NS
+record. Each name gets a rule with the -rpz-action, CNAME . for nxdomain, and
+with -rpz-wildcard, a *.name rule as well. A name with a target address other
+than an unspecified or loopback one gets A or AAAA records instead. A comment
+of the input holding a tag such as rpz:passthru or rpz:drop sets the action of
+its names. Read as input, the actions other than nxdomain are kept as such
+tags, passthru rules become comments and wildcard rules are dropped, so a zone
+converted to a hosts file and back keeps its policy. Feed the leaks found in a
+zone back to it with:
+
+	lpc -from rpz -in db.rpz -output-mode added > leaks
+	lpc convert -to rpz -in leaks -out leaks.rpz
+
+Queries advertise an EDNS0 UDP buffer size. A truncated response is retried
+over TCP.
+
+Connections to each resolver are shared between queries. A UDP socket is
+reused, matching responses to queries by ID and question, and TCP queries are
+pipelined on one connection. A connection closed by the resolver is dialed
+again. The number of dials and reuses is written to stderr at the end of the
+run. Use -pool=false to dial a new connection for each query.
+
+With -zone, queries are answered from RFC 1035 zone files without any network
+access, as an authoritative server would: NXDOMAIN and NODATA carry the SOA,
+CNAMEs are followed through the loaded zones, wildcards are expanded and
+delegations to zones not loaded are referrals. Each zone is defined by its SOA
+record. Give origin=path for a file with relative names and no $ORIGIN.
+
+For very large lists, the names can be resolved beforehand by a mass resolver
+and the results given with -import. The JSON lines output of massdns (-o J)
+and zdns, and the simple output of massdns (-o S) are read. A query missing
+from the results fails with "query not imported", so names.txt below must hold
+each entry of the hosts file and its prefixed name:
+
+	massdns -r resolvers.txt -o J -w results.json names.txt
+	lpc -import results.json -in hosts
+
+The simple output has no negative answers, so a name without records of the
+type is missing.
+
+With -cache, answers are kept in a file and reused by later runs until their
+TTL expires, so a run on a list that changed slightly only queries the new
+names. NXDOMAIN and empty answers are kept for the SOA minimum, and errors are
+not kept. An answer is reused only by runs sending the same queries, to the
+same resolvers or files, with the same -authoritative, -dnssec, -trust-anchor
+and -ecs, and the client subnet scope is kept with it. -cache-max-age ignores
+older answers and drops them from the file. -cache-only never queries the
+resolvers and also uses answers whose TTL expired, which are kept in the file,
+failing for names not in the cache. -cache-refresh queries every name and
+replaces the answers. No sleep is taken after a cached answer.
+
+With -record, every query and its response in wire format, or its error, is
+written to a capture file. A run with -replay answers the same queries from the
+capture without any network access, so a verdict can be reproduced later or
+attached to a bug report. The resolver flags are then ignored, and a query
+missing from the capture fails with "query not recorded". The canary queries on
+each resolver are recorded apart, so the replay finds the same filtering
+resolvers.
+
+On a host with several uplinks, -source-addr sends the queries from the given
+local addresses, such as -source-addr 192.0.2.1,2001:db8::1, using the one in
+the family of each resolver. -interface uses the addresses of a network
+interface instead, after those of -source-addr.
+
+With multiple resolvers, the failover policy queries them in order and moves to
+the next one on an error or SERVFAIL. The round-robin policy does the same
+starting at a different resolver for each query. The consensus policy queries
+every resolver and treats a name as resolving only if a quorum of them returned
+data, not counting sinkhole addresses, and answers with the data of one of
+them. Statistics of each resolver are written to stderr at the end of the run.
 
 Example:
 
 	cat /etc/hosts | lpc
 	lpc -in /etc/hosts -out hosts.tmp
+	lpc -managed -in hosts -output-mode diff | patch hosts
+	lpc -managed -in /etc/hosts -inplace -backup .bak
+	lpc -in hosts -inplace -prune comment -prune-after 3 -history dead.json
+	lpc -dns 8.8.8.8,1.1.1.1,9.9.9.9 -policy consensus -in /etc/hosts
+	lpc verify -dns 192.168.1.2 -in hosts.tmp
+	lpc plan -in /etc/hosts -sleep 50 > queries.tsv
+	lpc convert -from hosts -to unbound -in hosts -out blocklist.conf
+	lpc convert -from adblock -to rpz -rpz-wildcard -in list.txt -out db.rpz
+	lpc -in /etc/hosts -report report.ndjson -report-format ndjson
 */
 package main
@@ -0,0 +1,772 @@
+// lpc: Leaky Prefix Checker
+// Copyright (C) 2019  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/atomicfile"
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/hosts"
+	"github.com/mys721tx/lpc/pkg/report"
+	"github.com/mys721tx/lpc/pkg/resolver"
+	"github.com/mys721tx/lpc/pkg/rpz"
+)
+
+// resolverFlags defines the flags shared by the commands sending queries.
+func resolverFlags(fs *flag.FlagSet) {
+	fs.StringVar(
+		&pin,
+		"in",
+		"",
+		"path to the hosts file, default to stdin.",
+	)
+
+	fs.StringVar(
+		&host,
+		"dns",
+		"system",
+		"comma separated IP addresses of the resolvers, system or iterative, default to system.",
+	)
+
+	fs.StringVar(
+		&resolvConf,
+		"resolv-conf",
+		resolver.DefaultResolvConf,
+		"path to the system resolver configuration, default to /etc/resolv.conf",
+	)
+
+	fs.StringVar(
+		&policy,
+		"policy",
+		resolver.PolicyFailover,
+		"policy for multiple resolvers, failover, round-robin or consensus, default to failover",
+	)
+
+	fs.IntVar(
+		&quorum,
+		"quorum",
+		0,
+		"number of resolvers returning data for a consensus, default to a majority",
+	)
+
+	fs.StringVar(
+		&port,
+		"port",
+		"53",
+		"port of the resolvers without one, default to 53",
+	)
+
+	fs.StringVar(
+		&prefix,
+		"prefix",
+		"www.",
+		"prefix to check for each hosts entry, default to www.",
+	)
+
+	fs.Int64Var(
+		&timeout,
+		"timeout",
+		10,
+		"timeout for each DNS query, default to 10s",
+	)
+
+	fs.UintVar(
+		&bufSize,
+		"bufsize",
+		resolver.DefaultBufSize,
+		"EDNS0 UDP buffer size, 0 to disable EDNS0, default to 1232",
+	)
+
+	fs.StringVar(
+		&subnet,
+		"ecs",
+		"",
+		"client subnet sent in the EDNS0 Client Subnet option, default to none",
+	)
+
+	fs.BoolVar(
+		&useCookies,
+		"cookie",
+		false,
+		"send DNS cookies, default to false",
+	)
+
+	fs.StringVar(
+		&sourceAddr,
+		"source-addr",
+		"",
+		"comma separated local addresses of the queries, one per family, default to any",
+	)
+
+	fs.StringVar(
+		&iface,
+		"interface",
+		"",
+		"network interface whose addresses the queries are sent from, default to any",
+	)
+
+	fs.StringVar(
+		&cachePath,
+		"cache",
+		"",
+		"path to the answer cache file, default to none",
+	)
+
+	fs.Int64Var(
+		&cacheMaxAge,
+		"cache-max-age",
+		0,
+		"maximum age of the cached answers used in seconds, 0 for no limit, default to 0",
+	)
+
+	fs.BoolVar(
+		&cacheOnly,
+		"cache-only",
+		false,
+		"answer only from the cache, even after the TTL expired, default to false",
+	)
+
+	fs.BoolVar(
+		&cacheRefresh,
+		"cache-refresh",
+		false,
+		"query every name again and update the cache, default to false",
+	)
+
+	fs.StringVar(
+		&zoneFiles,
+		"zone",
+		"",
+		"comma separated zone files to answer from instead of the resolvers, each a path or origin=path, default to none",
+	)
+
+	fs.StringVar(
+		&importFiles,
+		"import",
+		"",
+		"comma separated massdns or zdns outputs to answer from instead of the resolvers, default to none",
+	)
+
+	fs.StringVar(
+		&recordPath,
+		"record",
+		"",
+		"path to write every query and response of the run to, default to none",
+	)
+
+	fs.StringVar(
+		&replayPath,
+		"replay",
+		"",
+		"path to a capture written by -record to answer the queries from, default to none",
+	)
+
+	fs.BoolVar(
+		&usePool,
+		"pool",
+		true,
+		"reuse connections to the resolvers between queries, default to true",
+	)
+
+	fs.StringVar(
+		&sinkhole,
+		"sinkhole",
+		check.DefaultSinkholes,
+		"comma separated addresses and CIDR blocks of filtered answers, default to 0.0.0.0/32,127.0.0.0/8,::/128,::1/128",
+	)
+
+	fs.Int64Var(
+		&sleep,
+		"sleep",
+		100,
+		"time between DNS query, default to 100ms",
+	)
+}
+
+// newResolver sets up the resolvers, the cache and the capture from the
+// parsed flags of fs. It returns the Resolver to query and the upstreams it
+// is built on, which are nil for the iterative resolver and a replay.
+func newResolver(fs *flag.FlagSet) (resolver.Resolver, *resolver.Multi) {
+	if replayPath != "" {
+		if recordPath != "" || cachePath != "" {
+			log.Panicf("-replay is exclusive with -record and -cache")
+		}
+
+		f, err := os.Open(replayPath)
+
+		if err != nil {
+			log.Panicf("failed to open %q: %v", replayPath, err)
+		}
+
+		defer f.Close()
+
+		rp, err := resolver.NewReplay(f)
+
+		if err != nil {
+			log.Panicf("failed to read %q: %v", replayPath, err)
+		}
+
+		return rp, nil
+	}
+
+	res, r := newBackend(fs)
+
+	if cachePath == "" && (cacheOnly || cacheRefresh) {
+		log.Panicf("-cache-only and -cache-refresh require -cache")
+	}
+
+	if cacheOnly && cacheRefresh {
+		log.Panicf("-cache-only and -cache-refresh are exclusive")
+	}
+
+	if cachePath != "" {
+		c, err := resolver.LoadCache(res, cachePath)
+
+		if err != nil {
+			log.Panicf("failed to read %q: %v", cachePath, err)
+		}
+
+		c.Options = cacheOptions()
+		c.MaxAge = time.Duration(cacheMaxAge) * time.Second
+		c.Only = cacheOnly
+		c.Refresh = cacheRefresh
+		cache = c
+		res = c
+	}
+
+	if recordPath != "" {
+		f, err := os.Create(recordPath)
+
+		if err != nil {
+			log.Panicf("failed to open %q: %v", recordPath, err)
+		}
+
+		record = f
+		res = resolver.NewRecorder(res, f)
+	}
+
+	return res, r
+}
+
+// cacheOptions describes the queries sent with the parsed flags, so cached
+// answers are only reused by runs sending the same queries.
+func cacheOptions() string {
+	var opts []string
+
+	switch {
+	case zoneFiles != "":
+		opts = append(opts, "zone="+zoneFiles)
+	case importFiles != "":
+		opts = append(opts, "import="+importFiles)
+	default:
+		opts = append(opts, "dns="+host)
+	}
+
+	if authoritative {
+		opts = append(opts, "authoritative")
+	}
+
+	if useDNSSEC {
+		opts = append(opts, "do")
+	}
+
+	if trustAnchor != "" {
+		opts = append(opts, "cd")
+	}
+
+	if subnet != "" {
+		opts = append(opts, "ecs="+subnet)
+	}
+
+	return strings.Join(opts, " ")
+}
+
+// newBackend sets up the resolvers answering the queries from the parsed
+// flags of fs.
+func newBackend(fs *flag.FlagSet) (resolver.Resolver, *resolver.Multi) {
+	if zoneFiles != "" {
+		z, err := resolver.LoadZones(strings.Split(zoneFiles, ","))
+
+		if err != nil {
+			log.Panicf("failed to load zones: %v", err)
+		}
+
+		return z, nil
+	}
+
+	if importFiles != "" {
+		im, err := resolver.LoadImport(strings.Split(importFiles, ","))
+
+		if err != nil {
+			log.Panicf("failed to import results: %v", err)
+		}
+
+		return im, nil
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if bufSize > dns.MaxMsgSize {
+		log.Panicf("invalid EDNS0 buffer size %d", bufSize)
+	}
+
+	c := resolver.Client{
+		Timeout:          time.Duration(timeout) * time.Second,
+		BufSize:          uint16(bufSize),
+		DNSSEC:           useDNSSEC,
+		CheckingDisabled: trustAnchor != "",
+	}
+
+	if subnet != "" {
+		pfx, err := netip.ParsePrefix(subnet)
+
+		if err != nil {
+			log.Panicf("failed to parse client subnet: %v", err)
+		}
+
+		c.Subnet = pfx
+	}
+
+	if useCookies {
+		c.Cookies = resolver.NewCookieJar()
+	}
+
+	sources, err := resolver.ParseSources(sourceAddr)
+
+	if err != nil {
+		log.Panicf("failed to parse source addresses: %v", err)
+	}
+
+	if iface != "" {
+		addrs, err := resolver.InterfaceAddrs(iface)
+
+		if err != nil {
+			log.Panicf("failed to read the addresses of %q: %v", iface, err)
+		}
+
+		sources = append(sources, addrs...)
+	}
+
+	c.Sources = sources
+
+	if usePool {
+		pool = resolver.NewPool()
+		c.Pool = pool
+	}
+
+	if host == "iterative" {
+		it := resolver.NewIterative(c)
+		it.Port = port
+
+		return it, nil
+	}
+
+	addrs := resolver.ParseUpstreams(host, port)
+	attempts := 1
+
+	if host == "" || host == "system" {
+		sys, err := resolver.LoadSystem(resolvConf)
+
+		if err != nil {
+			log.Panicf("failed to read %q: %v", resolvConf, err)
+		}
+
+		addrs = sys.Upstreams
+		attempts = sys.Attempts
+
+		if !set["timeout"] {
+			c.Timeout = sys.Timeout
+		}
+
+		if !set["policy"] && sys.Rotate {
+			policy = resolver.PolicyRoundRobin
+		}
+	}
+
+	r, err := resolver.NewMulti(addrs, policy, quorum, c)
+
+	if err != nil {
+		log.Panicf("failed to set up resolvers: %v", err)
+	}
+
+	r.Attempts = attempts
+
+	// Only answers that are not sinkholed vote for a consensus.
+	sinkholes := newSinkholes()
+	r.Data = func(m *dns.Msg) bool {
+		return check.Classify(m, sinkholes) == check.Resolves
+	}
+
+	if authoritative {
+		a := resolver.NewAuthoritative(r, c)
+		a.Port = port
+
+		return a, r
+	}
+
+	return r, r
+}
+
+// probes returns the upstreams queried on their own, such as for the
+// canary: those of the resolver, recorded with -record, or those recorded in
+// the capture with -replay.
+func probes(
+	r resolver.Resolver,
+	upstreams *resolver.Multi,
+) []*resolver.Upstream {
+	if rp, ok := r.(*resolver.Replay); ok {
+		return rp.Upstreams()
+	}
+
+	if upstreams == nil {
+		return nil
+	}
+
+	rec, ok := r.(*resolver.Recorder)
+
+	if !ok {
+		return upstreams.Upstreams
+	}
+
+	us := make([]*resolver.Upstream, len(upstreams.Upstreams))
+
+	for i, u := range upstreams.Upstreams {
+		us[i] = &resolver.Upstream{Name: u.Name, Resolver: rec.Probe(u)}
+	}
+
+	return us
+}
+
+// newSinkholes parses the sinkhole flag.
+func newSinkholes() check.Sinkholes {
+	sinkholes, err := check.ParseSinkholes(sinkhole)
+
+	if err != nil {
+		log.Panicf("failed to parse sinkholes: %v", err)
+	}
+
+	return sinkholes
+}
+
+// printStats writes the statistics of each upstream and of the connection
+// pool to stderr.
+func printStats(res resolver.Resolver, r *resolver.Multi) {
+	if rec, ok := res.(*resolver.Recorder); ok {
+		res = rec.Resolver
+	}
+
+	if c, ok := res.(*resolver.Cache); ok {
+		fmt.Fprintf(
+			os.Stderr,
+			"cache: %d hits, %d misses\n",
+			c.Hits,
+			c.Misses,
+		)
+
+		res = c.Resolver
+	}
+
+	if a, ok := res.(*resolver.Authoritative); ok {
+		fmt.Fprintf(
+			os.Stderr,
+			"authoritative: %d direct, %d fallbacks\n",
+			a.Direct,
+			a.Fallbacks,
+		)
+	}
+
+	if it, ok := res.(*resolver.Iterative); ok {
+		fmt.Fprintf(
+			os.Stderr,
+			"iterative: %d queries, %d cache hits\n",
+			it.Queries,
+			it.Hits,
+		)
+	}
+
+	if pool != nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"pool: %d dials, %d reuses\n",
+			pool.Dials,
+			pool.Reuses,
+		)
+	}
+
+	if r == nil {
+		return
+	}
+
+	for _, u := range r.Upstreams {
+		fmt.Fprintln(os.Stderr, "upstream", u.Name+":", u.Stats)
+	}
+}
+
+// closeResolver writes the cache back to its file and closes the capture.
+func closeResolver() {
+	if cache != nil {
+		if err := cache.Save(cachePath); err != nil {
+			log.Panicf("failed to write %q: %v", cachePath, err)
+		}
+	}
+
+	if record != nil {
+		if err := record.Close(); err != nil {
+			log.Panicf("failed to close %q: %v", recordPath, err)
+		}
+	}
+}
+
+// pause sleeps between queries, unless res was answered without the
+// network, from the cache, a replay, zone files or imported results.
+func pause(res *resolver.Result) {
+	if replayPath != "" ||
+		(res != nil && res.Transport != resolver.TransportUDP &&
+			res.Transport != resolver.TransportTCP) {
+		return
+	}
+
+	time.Sleep(time.Duration(sleep) * time.Millisecond)
+}
+
+// resolve queries the A records of name, returning the time taken, then
+// pauses.
+func resolve(
+	r resolver.Resolver,
+	name string,
+) (*resolver.Result, time.Duration, error) {
+	start := time.Now()
+	res, err := r.Resolve(name, dns.TypeA)
+	elapsed := time.Since(start)
+
+	pause(res)
+
+	return res, elapsed, err
+}
+
+// paced is a Resolver pausing after each query.
+type paced struct {
+	resolver.Resolver
+}
+
+func (p paced) Resolve(name string, qtype uint16) (*resolver.Result, error) {
+	res, err := p.Resolver.Resolve(name, qtype)
+
+	pause(res)
+
+	return res, err
+}
+
+// reportFlags defines the flags of the report of the checked names.
+func reportFlags(fs *flag.FlagSet) {
+	fs.StringVar(
+		&reportPath,
+		"report",
+		"",
+		"path to the report of every checked name, default to none",
+	)
+
+	fs.StringVar(
+		&reportFormat,
+		"report-format",
+		report.FormatJSON,
+		"format of the report, json, ndjson, csv, markdown or html, default to json",
+	)
+}
+
+// openReport creates the report file if reportPath is set.
+func openReport() {
+	if reportPath == "" {
+		return
+	}
+
+	f, err := os.Create(reportPath)
+
+	if err != nil {
+		log.Panicf("failed to open %q: %v", reportPath, err)
+	}
+
+	rep, err = report.NewWriter(f, reportFormat)
+
+	if err != nil {
+		log.Panicf("failed to write %q: %v", reportPath, err)
+	}
+
+	reportFile = f
+}
+
+// writeReport writes rec to the report if one is open.
+func writeReport(rec *report.Record) {
+	if rep == nil {
+		return
+	}
+
+	if err := rep.Write(rec); err != nil {
+		log.Panicf("failed to write %q: %v", reportPath, err)
+	}
+}
+
+// closeReport ends the report and closes its file.
+func closeReport() {
+	if rep == nil {
+		return
+	}
+
+	if err := rep.Close(); err != nil {
+		log.Panicf("failed to write %q: %v", reportPath, err)
+	}
+
+	if err := reportFile.Close(); err != nil {
+		log.Panicf("failed to close %q: %v", reportPath, err)
+	}
+}
+
+// openIn opens the input file, or stdin if the path is empty.
+func openIn(path string) *os.File {
+	if path == "" {
+		return os.Stdin
+	}
+
+	f, err := os.Open(path)
+
+	if err != nil {
+		log.Panicf("failed to open %q: %v", path, err)
+	}
+
+	return f
+}
+
+// newHistory loads the history of the dead entries, or returns an empty one
+// if there is no history file.
+func newHistory() *check.History {
+	switch pruneAction {
+	case "", pruneComment, pruneRemove:
+	default:
+		log.Panicf("unknown prune action %q", pruneAction)
+	}
+
+	if historyPath == "" {
+		if pruneAfter > 1 {
+			log.Panicf("-prune-after requires -history")
+		}
+
+		return check.NewHistory()
+	}
+
+	h, err := check.LoadHistory(historyPath)
+
+	if err != nil {
+		log.Panicf("failed to read %q: %v", historyPath, err)
+	}
+
+	return h
+}
+
+// rpzFlag defines the flag of the origin of a response policy zone.
+func rpzFlag(fs *flag.FlagSet) {
+	fs.StringVar(
+		&rpzOrigin,
+		"rpz-origin",
+		"rpz.local",
+		"origin of the response policy zone, default to rpz.local",
+	)
+}
+
+// readRPZ reads the response policy zone in as a hosts file, and returns the
+// function reporting whether the zone decides a name already.
+func readRPZ(in io.Reader) (io.Reader, func(string) bool) {
+	z, err := rpz.Parse(in, rpzOrigin, pin)
+
+	if err != nil {
+		log.Panicf("failed to read %q: %v", pin, err)
+	}
+
+	if z.Skipped > 0 {
+		fmt.Fprintln(
+			os.Stderr,
+			"skipped",
+			z.Skipped,
+			"records not in the rpz format",
+		)
+	}
+
+	var buf bytes.Buffer
+
+	for _, l := range z.Lines() {
+		for _, s := range hosts.Formats["hosts"].Format(l, tgt) {
+			fmt.Fprintln(&buf, s)
+		}
+	}
+
+	return &buf, z.Covers
+}
+
+// createInplace creates the file replacing the input file.
+func createInplace() *atomicfile.File {
+	switch {
+	case pin == "":
+		log.Panicf("-inplace requires -in")
+	case pout != "":
+		log.Panicf("-inplace and -out are exclusive")
+	case inFormat != "hosts":
+		log.Panicf("-inplace requires a hosts file")
+	case outputMode != modeFull:
+		log.Panicf("-inplace requires -output-mode full")
+	}
+
+	f, err := atomicfile.Create(pin)
+
+	if err != nil {
+		log.Panicf("failed to open %q: %v", pin, err)
+	}
+
+	return f
+}
+
+// openOut creates the output file, or returns stdout if the path is empty.
+// The input file is never truncated before it is read.
+func openOut(path string) *os.File {
+	if path == "" {
+		return os.Stdout
+	}
+
+	if fi, err := os.Stat(path); err == nil && pin != "" {
+		if in, err := os.Stat(pin); err == nil && os.SameFile(fi, in) {
+			log.Panicf("output %q is the input file, use -inplace", path)
+		}
+	}
+
+	f, err := os.Create(path)
+
+	if err != nil {
+		log.Panicf("failed to open %q: %v", path, err)
+	}
+
+	return f
+}
@@ -5,13 +5,13 @@ go 1.25.0
 require (
 	github.com/miekg/dns v1.1.72
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/net v0.55.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/mod v0.31.0 // indirect
-	golang.org/x/net v0.55.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
 	golang.org/x/sys v0.45.0 // indirect
 	golang.org/x/tools v0.40.0 // indirect
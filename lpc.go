@@ -20,22 +20,69 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/dnssec"
 	"github.com/mys721tx/lpc/pkg/hosts"
+	"github.com/mys721tx/lpc/pkg/report"
+	"github.com/mys721tx/lpc/pkg/resolver"
 )
 
 var (
 	pin, pout      string
 	host, port     string
+	resolvConf     string
 	tgt, prefix    string
+	policy         string
+	sinkhole       string
+	canary         string
 	sleep, timeout int64
+	bufSize        uint
+	quorum         int
+	useDNSSEC      bool
+	trustAnchor    string
+	subnet         string
+	useCookies     bool
+	usePool        bool
+	sourceAddr     string
+	iface          string
+	cachePath      string
+	cacheMaxAge    int64
+	cacheOnly      bool
+	cacheRefresh   bool
+	recordPath     string
+	replayPath     string
+	zoneFiles      string
+	importFiles    string
+	authoritative  bool
+	reportPath     string
+	reportFormat   string
+	checkWildcard  bool
+	outputMode     string
+	managed        bool
+	inplace        bool
+	backup         string
+	pruneAction    string
+	pruneAfter     int
+	historyPath    string
+	rpzOrigin      string
+	inFormat       string
+	// pool shares the connections of the queries if usePool is set.
+	pool *resolver.Pool
+	// cache answers the queries if cachePath is set.
+	cache *resolver.Cache
+	// record is the capture written if recordPath is set.
+	record *os.File
+	// rep writes the report to reportFile if reportPath is set.
+	rep        report.Writer
+	reportFile *os.File
 )
 
 func bldJoin(b *strings.Builder, strs ...string) {
@@ -45,98 +92,211 @@ func bldJoin(b *strings.Builder, strs ...string) {
 	}
 }
 
+// security returns the DNSSEC status of a response, validated locally by v
+// or reported by the upstream if v is nil.
+func security(v *dnssec.Validator, m *dns.Msg) dnssec.Status {
+	if v == nil {
+		return dnssec.FromAD(m)
+	}
+
+	st, err := v.Validate(m)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error validating", m.Question[0].Name, err)
+	}
+
+	return st
+}
+
 func main() {
-	flag.StringVar(
-		&pin,
-		"in",
-		"",
-		"path to the hosts file, default to stdin.",
-	)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(verify(os.Args[2:]))
+		case "plan":
+			os.Exit(plan(os.Args[2:]))
+		case "convert":
+			os.Exit(convert(os.Args[2:]))
+		}
+	}
+
+	run(os.Args[1:])
+}
+
+// run checks a hosts file and writes it with the leaking prefixed names.
+func run(args []string) {
+	fs := flag.CommandLine
+
+	resolverFlags(fs)
 
-	flag.StringVar(
+	fs.StringVar(
 		&pout,
 		"out",
 		"",
 		"path to the output file, default to stdout.",
 	)
 
-	flag.StringVar(
-		&host,
-		"dns",
-		"8.8.8.8",
-		"IP address of the resolver, default to 8.8.8.8.",
+	fs.StringVar(
+		&inFormat,
+		"from",
+		"hosts",
+		"format of the input, hosts or rpz, default to hosts",
+	)
+
+	rpzFlag(fs)
+
+	fs.BoolVar(
+		&inplace,
+		"inplace",
+		false,
+		"replace the input file atomically with the output, default to false",
+	)
+
+	fs.StringVar(
+		&backup,
+		"backup",
+		"",
+		"suffix of the copy of the input file kept with -inplace, default to none",
+	)
+
+	fs.StringVar(
+		&outputMode,
+		"output-mode",
+		modeFull,
+		"lines written, full, added, changed or diff, default to full",
+	)
+
+	fs.BoolVar(
+		&managed,
+		"managed",
+		false,
+		"write the added entries in the managed section, replaced on each run, default to false",
 	)
 
-	flag.StringVar(
-		&port,
-		"port",
-		"53",
-		"port of the resolver, default to 53",
+	fs.StringVar(
+		&pruneAction,
+		"prune",
+		"",
+		"comment or remove the dead entries, default to none",
 	)
 
-	flag.StringVar(
-		&prefix,
-		"prefix",
-		"www.",
-		"prefix to check for each hosts entry, default to www.",
+	fs.IntVar(
+		&pruneAfter,
+		"prune-after",
+		1,
+		"number of consecutive runs an entry is dead before it is pruned, default to 1",
 	)
 
-	flag.Int64Var(
-		&timeout,
-		"timeout",
-		10,
-		"timeout for each DNS query, default to 10s",
+	fs.StringVar(
+		&historyPath,
+		"history",
+		"",
+		"path to the history of the dead entries, default to none",
 	)
 
-	flag.StringVar(
+	fs.StringVar(
 		&tgt,
 		"tgt",
 		"0.0.0.0",
 		"target IP address of the blocked entry, default to 0.0.0.0",
 	)
 
-	flag.Int64Var(
-		&sleep,
-		"sleep",
-		100,
-		"time between DNS query, default to 100ms",
+	fs.StringVar(
+		&canary,
+		"canary",
+		check.DefaultCanary,
+		"name queried to detect a filtering resolver, empty to disable, default to ad.doubleclick.net",
 	)
 
-	flag.Parse()
+	fs.BoolVar(
+		&useDNSSEC,
+		"dnssec",
+		false,
+		"request DNSSEC records and annotate the DNSSEC status of the added entries, default to false",
+	)
 
-	addr := net.JoinHostPort(host, port)
+	fs.StringVar(
+		&trustAnchor,
+		"trust-anchor",
+		"",
+		"path to the DS or DNSKEY trust anchors to validate locally, implies -dnssec",
+	)
 
-	var fin, fout *os.File
+	fs.BoolVar(
+		&authoritative,
+		"authoritative",
+		false,
+		"query the authoritative nameservers of each zone directly, default to false",
+	)
 
-	if pin == "" {
-		fin = os.Stdin
-	} else if f, err := os.Open(pin); err != nil {
-		log.Panicf("failed to open %q: %v", pin, err)
-	} else {
-		fin = f
+	fs.BoolVar(
+		&checkWildcard,
+		"wildcard",
+		false,
+		"query a name under each leaking entry to annotate the wildcards, default to false",
+	)
+
+	reportFlags(fs)
+
+	fs.Parse(args)
+
+	if trustAnchor != "" {
+		useDNSSEC = true
 	}
 
-	if pout == "" {
-		fout = os.Stdout
-	} else if f, err := os.Create(pout); err != nil {
-		log.Panicf("failed to open %q: %v", pout, err)
-	} else {
-		fout = f
+	// The output read from a zone is a hosts file, which cannot patch it.
+	if inFormat == formatRPZ && (managed || outputMode == modeDiff) {
+		log.Panicf("-managed and -output-mode diff require a hosts file")
 	}
 
+	fin := openIn(pin)
+
 	defer func() {
 		if err := fin.Close(); err != nil {
 			log.Panicf("failed to close %q: %v", pin, err)
 		}
 	}()
 
-	defer func() {
-		if err := fout.Close(); err != nil {
-			log.Panicf("failed to close %q: %v", pout, err)
-		}
-	}()
+	var fout *os.File
+
+	if inplace {
+		af := createInplace()
+		fout = af.File
+
+		// The input is replaced only if the run completes.
+		defer func() {
+			if p := recover(); p != nil {
+				af.Abort()
+				panic(p)
+			}
 
-	scn := bufio.NewScanner(fin)
+			if err := af.Commit(backup); err != nil {
+				log.Panicf("failed to replace %q: %v", pin, err)
+			}
+		}()
+	} else {
+		fout = openOut(pout)
+
+		defer func() {
+			if err := fout.Close(); err != nil {
+				log.Panicf("failed to close %q: %v", pout, err)
+			}
+		}()
+	}
+
+	var in io.Reader = fin
+
+	covered := func(string) bool { return false }
+
+	switch inFormat {
+	case "hosts":
+	case formatRPZ:
+		in, covered = readRPZ(fin)
+	default:
+		log.Panicf("unknown format %q", inFormat)
+	}
+
+	scn := bufio.NewScanner(in)
 	w := bufio.NewWriter(fout)
 
 	defer func() {
@@ -145,38 +305,160 @@ func main() {
 		}
 	}()
 
+	name := pin
+
+	if name == "" {
+		name = "stdin"
+	}
+
+	o := newOutput(w, outputMode, name)
+	o.managed = managed
+	o.prune = pruneAction
+
+	defer func() {
+		if err := o.close(); err != nil {
+			log.Panicf("failed to write %q: %v", pout, err)
+		}
+	}()
+
 	names := make(map[string]bool)
+	planner := check.NewPlanner(prefix)
+
+	r, upstreams := newResolver(fs)
+
+	defer printStats(r, upstreams)
+	defer closeResolver()
+
+	openReport()
+
+	defer closeReport()
+
+	sinkholes := newSinkholes()
+
+	var v *dnssec.Validator
+
+	if trustAnchor != "" {
+		anchors, err := dnssec.LoadAnchors(trustAnchor)
+
+		if err != nil {
+			log.Panicf("failed to read %q: %v", trustAnchor, err)
+		}
+
+		v = dnssec.NewValidator(r, anchors)
+	}
+
+	history := newHistory()
+	filtering := false
+
+	if canary != "" {
+		for _, u := range probes(r, upstreams) {
+			f, err := check.IsFiltering(u.Resolver, canary, sinkholes)
 
-	c := new(dns.Client)
-	c.Timeout = time.Duration(timeout) * time.Second
-	m := new(dns.Msg)
+			if err != nil {
+				fmt.Fprintln(
+					os.Stderr,
+					"error querying canary",
+					canary,
+					"on upstream",
+					u.Name,
+					err,
+				)
+			} else if f {
+				filtering = true
+
+				fmt.Fprintln(
+					os.Stderr,
+					"upstream",
+					u.Name,
+					"is filtering, blocked names are not leaks",
+				)
+			}
+		}
+	}
+
+	// A blocked name is not dead, so nothing is pruned or counted.
+	if filtering && pruneAction != "" {
+		fmt.Fprintln(os.Stderr, "upstream is filtering, no entry is pruned")
+
+		pruneAction = ""
+		o.prune = ""
+		historyPath = ""
+	}
+
+	lineNo := 0
+	started := time.Now()
+	pruned := 0
 
 	for scn.Scan() {
 		line := scn.Text()
+		lineNo++
+
+		// Drop the managed section of the previous run.
+		if o.skip(line) {
+			continue
+		}
 
 		ip, hns, cmt := hosts.ParseLine(line)
 
 		// Do not further process empty or commented line.
 		if ip == "" {
-			fmt.Fprintln(w, line)
+			o.add(kept, line)
+			o.end(line)
 			continue
 		}
 
+		cands := planner.Line(hns)
+		planned := make(map[string]bool)
+
+		for _, c := range cands {
+			planned[c.Name] = true
+		}
+
+		// Whether every entry of the line is pruned.
+		dead := len(hns) > 0
+
 		// Process multi entry lines
 		for _, fld := range hns {
-			if _, exist := names[fld]; !exist {
-				m.SetQuestion(dns.Fqdn(fld), dns.TypeA)
-				in, _, err := c.Exchange(m, addr)
-				time.Sleep(time.Duration(sleep) * time.Millisecond)
+			if names[fld] {
+				dead = false
+				continue
+			}
 
-				var b strings.Builder
+			var b strings.Builder
+
+			bldJoin(&b, ip, " ", fld)
+
+			if cmt != "" {
+				bldJoin(&b, " #", cmt)
+			}
 
-				bldJoin(&b, ip, " ", fld)
+			k := entry
+			prunable := false
 
-				if cmt != "" {
-					bldJoin(&b, " #", cmt)
+			if planned[fld] {
+				res, elapsed, err := resolve(r, fld)
+				rec := report.NewRecord(
+					check.Candidate{Name: fld, Qtype: dns.TypeA, From: fld},
+					lineNo,
+					prefix,
+					res,
+					err,
+					elapsed,
+					sinkholes,
+				)
+				rec.Source = line
+
+				if useDNSSEC && err == nil {
+					rec.DNSSEC = string(security(v, res.Msg))
 				}
 
+				runs := history.Observe(fld, rec.Class, started)
+				prunable = pruneAction != "" &&
+					rec.Class == check.NXDomain &&
+					runs >= pruneAfter
+
+				writeReport(rec)
+
 				if err != nil {
 					fmt.Fprintln(
 						os.Stderr,
@@ -184,35 +466,56 @@ func main() {
 						fld,
 						err,
 					)
-				} else {
-
-					if in.MsgHdr.Rcode != dns.RcodeSuccess {
-						if cmt == "" {
-							b.WriteString(" #")
-						}
-						b.WriteString(
-							dns.RcodeToString[in.MsgHdr.Rcode],
-						)
+				} else if res.Msg.Rcode != dns.RcodeSuccess {
+					if cmt == "" {
+						b.WriteString(" #")
 					}
+					b.WriteString(
+						dns.RcodeToString[res.Msg.Rcode],
+					)
+					k = annotated
 				}
+			}
 
-				if _, exist := names[fld]; !exist {
-					fmt.Fprintln(w, b.String())
-					names[fld] = true
-				}
+			dead = dead && prunable
+
+			if o.entry(k, b.String(), prunable) {
+				pruned++
 			}
+
+			names[fld] = true
 		}
 
-		for _, dom := range hns {
-			domPfx := prefix + dom
+		if o.whole(line, dead) {
+			pruned += len(hns)
+		}
 
-			if _, exist := names[domPfx]; exist {
+		for _, c := range cands {
+			// A name decided by the zone read is not a leak.
+			if !c.Prefixed() || covered(c.Name) {
 				continue
 			}
 
-			m.SetQuestion(dns.Fqdn(domPfx), dns.TypeA)
-			in, _, err := c.Exchange(m, addr)
-			time.Sleep(time.Duration(sleep) * time.Millisecond)
+			domPfx := c.Name
+
+			res, elapsed, err := resolve(r, domPfx)
+			rec := report.NewRecord(
+				c,
+				lineNo,
+				prefix,
+				res,
+				err,
+				elapsed,
+				sinkholes,
+			)
+			rec.Source = line
+
+			var st dnssec.Status
+
+			if useDNSSEC && err == nil {
+				st = security(v, res.Msg)
+				rec.DNSSEC = string(st)
+			}
 
 			if err != nil {
 				fmt.Fprintln(
@@ -221,22 +524,106 @@ func main() {
 					domPfx,
 					err,
 				)
-			} else if in.MsgHdr.Rcode == dns.RcodeSuccess {
-				fmt.Fprintln(w, tgt, domPfx)
+			} else if cls := check.Classify(
+				res.Msg,
+				sinkholes,
+			); cls == check.Resolves {
+				var b strings.Builder
+
+				bldJoin(&b, tgt, " ", domPfx)
+
+				var notes []string
+
+				if useDNSSEC {
+					if st == dnssec.Bogus {
+						fmt.Fprintln(
+							os.Stderr,
+							"bogus domain",
+							domPfx,
+						)
+						writeReport(rec)
+						continue
+					}
+
+					notes = append(notes, string(st))
+				}
+
+				if res.Scope.IsValid() {
+					notes = append(notes, "scope "+res.Scope.String())
+				}
+
+				if checkWildcard {
+					wc, err := check.IsWildcard(
+						paced{r},
+						c.From,
+						sinkholes,
+					)
+
+					if err != nil {
+						fmt.Fprintln(
+							os.Stderr,
+							"error checking wildcard",
+							c.From,
+							err,
+						)
+					} else if wc {
+						rec.Wildcard = true
+						notes = append(notes, "wildcard")
+					}
+				}
+
+				if len(notes) > 0 {
+					bldJoin(&b, " # ", strings.Join(notes, ", "))
+				}
+
+				o.add(added, b.String())
 				names[domPfx] = true
+				rec.Added = true
+			} else if cls == check.Filtered {
+				fmt.Fprintln(
+					os.Stderr,
+					"filtered domain",
+					domPfx,
+				)
 			} else {
 				fmt.Fprintln(
 					os.Stderr,
 					"error processing domain",
 					domPfx,
-					dns.RcodeToString[in.MsgHdr.Rcode],
+					dns.RcodeToString[res.Msg.Rcode],
+					"over",
+					res.Transport,
 				)
 			}
 
+			writeReport(rec)
 		}
+
+		o.end(line)
 	}
 
 	if err := scn.Err(); err != nil {
+		if inplace {
+			log.Panicf("failed to read %q: %v", pin, err)
+		}
+
 		fmt.Fprintln(os.Stderr, "reading standard input:", err)
 	}
+
+	if historyPath != "" {
+		if err := history.Save(historyPath); err != nil {
+			log.Panicf("failed to write %q: %v", historyPath, err)
+		}
+	}
+
+	if pruneAction != "" {
+		fmt.Fprintln(os.Stderr, "pruned", pruned, "dead entries")
+	}
+
+	if o.unterminated() {
+		fmt.Fprintln(
+			os.Stderr,
+			"managed section not ended, kept as is and no entries added",
+		)
+	}
 }
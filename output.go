@@ -0,0 +1,235 @@
+// lpc: Leaky Prefix Checker
+// Copyright (C) 2019  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+
+	"github.com/mys721tx/lpc/pkg/diff"
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+// Modes of the output.
+const (
+	modeFull    = "full"
+	modeAdded   = "added"
+	modeChanged = "changed"
+	modeDiff    = "diff"
+)
+
+// Actions on the dead entries.
+const (
+	pruneComment = "comment"
+	pruneRemove  = "remove"
+)
+
+// kind is the kind of a line written for a line of the input.
+type kind int
+
+const (
+	// kept is a line of the input written as is.
+	kept kind = iota
+	// entry is an entry of a line of the input.
+	entry
+	// annotated is an entry annotated with the rcode of its query.
+	annotated
+	// added is a prefixed entry added.
+	added
+	// commented is a dead entry commented out.
+	commented
+)
+
+// output writes the lines written for each line of the input in a mode.
+// If managed, the added entries are written in the managed section at the
+// end instead. Dead entries are pruned by the action prune, if any.
+type output struct {
+	w       io.Writer
+	mode    string
+	managed bool
+	prune   string
+	diff    *diff.Unified
+	lines   []string
+	section []string
+	// input tracks the managed section of the input, its lines held in open
+	// until it ends.
+	input hosts.Section
+	open  []string
+	// stale is the managed section of the input, removed from the diff once
+	// a line follows it.
+	stale []string
+}
+
+// newOutput returns an output writing to w in mode, the diff of the input
+// named name in modeDiff.
+func newOutput(w io.Writer, mode, name string) *output {
+	o := &output{w: w, mode: mode}
+
+	switch mode {
+	case modeFull, modeAdded, modeChanged:
+	case modeDiff:
+		o.diff = diff.NewUnified(w, name, name)
+	default:
+		log.Panicf("unknown output mode %q", mode)
+	}
+
+	return o
+}
+
+// add writes a line for the current line of the input.
+func (o *output) add(k kind, line string) {
+	switch {
+	case o.managed && k == added && o.mode != modeAdded:
+		o.section = append(o.section, line)
+	case o.mode == modeDiff:
+		o.lines = append(o.lines, line)
+	case o.mode == modeFull,
+		k == added,
+		o.mode == modeChanged && (k == annotated || k == commented):
+		fmt.Fprintln(o.w, line)
+	}
+}
+
+// entry writes the entry line for the current line of the input, pruned if
+// prunable. It reports whether the entry is pruned. If managed, the line of
+// the input is written whole instead.
+func (o *output) entry(k kind, line string, prunable bool) bool {
+	switch {
+	case o.managed:
+		return false
+	case prunable && o.prune == pruneRemove:
+	case prunable:
+		o.add(commented, "# "+line)
+	default:
+		o.add(k, line)
+
+		return false
+	}
+
+	return true
+}
+
+// whole writes line of the input as is if managed, pruned if every entry of
+// it is dead. It reports whether the line is pruned. Lines outside of the
+// managed section are only rewritten to prune them whole.
+func (o *output) whole(line string, dead bool) bool {
+	switch {
+	case !o.managed:
+		return false
+	case dead && o.prune == pruneRemove:
+	case dead:
+		o.add(commented, "# "+line)
+	default:
+		o.add(kept, line)
+
+		return false
+	}
+
+	return true
+}
+
+// end ends the lines written for line of the input.
+func (o *output) end(line string) {
+	if o.diff != nil {
+		o.removeStale()
+		o.diff.Line(line, o.lines)
+		o.lines = o.lines[:0]
+	}
+}
+
+// skip reports whether line is in the managed section of the input, which
+// is dropped once it ends.
+func (o *output) skip(line string) bool {
+	if !o.managed || !o.input.Managed(line) {
+		return false
+	}
+
+	o.open = append(o.open, line)
+
+	if !o.input.Open() {
+		if o.diff != nil {
+			o.stale = append(o.stale, o.open...)
+		}
+
+		o.open = nil
+	}
+
+	return true
+}
+
+// unterminated keeps an unterminated managed section of the input as is
+// rather than dropping the lines after it, and adds no section that the next
+// run would take as its end. It reports whether the section is unterminated.
+func (o *output) unterminated() bool {
+	if len(o.open) == 0 {
+		return false
+	}
+
+	for _, line := range o.open {
+		o.add(kept, line)
+		o.end(line)
+	}
+
+	o.open = nil
+	o.section = nil
+
+	return true
+}
+
+// removeStale removes the managed section of the input from the diff.
+func (o *output) removeStale() {
+	for _, line := range o.stale {
+		o.diff.Line(line, nil)
+	}
+
+	o.stale = nil
+}
+
+// close writes the managed section and the end of the diff.
+func (o *output) close() error {
+	var lines []string
+
+	if len(o.section) > 0 {
+		lines = append(lines, hosts.BeginManaged)
+		lines = append(lines, o.section...)
+		lines = append(lines, hosts.EndManaged)
+	}
+
+	if o.diff != nil {
+		// A section at the end of the input is unchanged if it is equal.
+		if slices.Equal(o.stale, lines) {
+			for _, line := range lines {
+				o.diff.Line(line, []string{line})
+			}
+		} else {
+			o.removeStale()
+			o.diff.Insert(lines)
+		}
+
+		return o.diff.Close()
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(o.w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+// write writes the lines in through o as the run does, adding the entries
+// adds after a line and pruning the entries of the lines dead. It returns
+// the output, the number of entries pruned and whether the managed section
+// of in is unterminated.
+func write(
+	t *testing.T,
+	o *output,
+	w *strings.Builder,
+	in []string,
+	adds map[string][]string,
+	dead map[string]bool,
+) (string, int, bool) {
+	t.Helper()
+
+	pruned := 0
+
+	for _, line := range in {
+		if o.skip(line) {
+			continue
+		}
+
+		ip, hns, _ := hosts.ParseLine(line)
+
+		if ip == "" {
+			o.add(kept, line)
+			o.end(line)
+			continue
+		}
+
+		for _, fld := range hns {
+			if o.entry(entry, ip+" "+fld, dead[line]) {
+				pruned++
+			}
+		}
+
+		if o.whole(line, dead[line]) {
+			pruned += len(hns)
+		}
+
+		for _, a := range adds[line] {
+			o.add(added, a)
+		}
+
+		o.end(line)
+	}
+
+	u := o.unterminated()
+
+	assert.NoError(t, o.close())
+
+	return w.String(), pruned, u
+}
+
+// lines joins lines as a file.
+func lines(l ...string) string {
+	return strings.Join(l, "\n") + "\n"
+}
+
+func TestOutput(t *testing.T) {
+	adds := map[string][]string{
+		"0.0.0.0 a.com": {"0.0.0.0 www.a.com"},
+	}
+
+	tests := []struct {
+		name    string
+		mode    string
+		managed bool
+		prune   string
+		in      []string
+		dead    map[string]bool
+		want    string
+		pruned  int
+		open    bool
+	}{
+		{
+			name: "full",
+			mode: modeFull,
+			in:   []string{"# hosts", "0.0.0.0 a.com"},
+			want: lines("# hosts", "0.0.0.0 a.com", "0.0.0.0 www.a.com"),
+		},
+		{
+			name:    "managed",
+			mode:    modeFull,
+			managed: true,
+			in:      []string{"0.0.0.0 a.com", "0.0.0.0 b.com"},
+			want: lines(
+				"0.0.0.0 a.com",
+				"0.0.0.0 b.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+			),
+		},
+		{
+			name:    "managed section replaced",
+			mode:    modeFull,
+			managed: true,
+			in: []string{
+				hosts.BeginManaged,
+				"0.0.0.0 www.old.com",
+				hosts.EndManaged,
+				"0.0.0.0 a.com",
+			},
+			want: lines(
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+			),
+		},
+		{
+			name:    "unchanged trailing section diff",
+			mode:    modeDiff,
+			managed: true,
+			in: []string{
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+			},
+			want: "",
+		},
+		{
+			name:    "changed trailing section diff",
+			mode:    modeDiff,
+			managed: true,
+			in: []string{
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.old.com",
+				hosts.EndManaged,
+			},
+			want: lines(
+				"--- hosts",
+				"+++ hosts",
+				"@@ -1,4 +1,4 @@",
+				" 0.0.0.0 a.com",
+				"-"+hosts.BeginManaged,
+				"-0.0.0.0 www.old.com",
+				"-"+hosts.EndManaged,
+				"+"+hosts.BeginManaged,
+				"+0.0.0.0 www.a.com",
+				"+"+hosts.EndManaged,
+			),
+		},
+		{
+			name:    "moved section diff",
+			mode:    modeDiff,
+			managed: true,
+			in: []string{
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+				"0.0.0.0 a.com",
+			},
+			want: lines(
+				"--- hosts",
+				"+++ hosts",
+				"@@ -1,4 +1,4 @@",
+				"-"+hosts.BeginManaged,
+				"-0.0.0.0 www.a.com",
+				"-"+hosts.EndManaged,
+				" 0.0.0.0 a.com",
+				"+"+hosts.BeginManaged,
+				"+0.0.0.0 www.a.com",
+				"+"+hosts.EndManaged,
+			),
+		},
+		{
+			name:    "unterminated section",
+			mode:    modeFull,
+			managed: true,
+			in: []string{
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 b.com",
+			},
+			want: lines(
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 b.com",
+			),
+			open: true,
+		},
+		{
+			name:    "unterminated section diff",
+			mode:    modeDiff,
+			managed: true,
+			in: []string{
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 b.com",
+			},
+			want: "",
+			open: true,
+		},
+		{
+			name:  "prune comment",
+			mode:  modeFull,
+			prune: pruneComment,
+			in:    []string{"0.0.0.0 a.com", "0.0.0.0 b.com c.com"},
+			dead:  map[string]bool{"0.0.0.0 b.com c.com": true},
+			want: lines(
+				"0.0.0.0 a.com",
+				"0.0.0.0 www.a.com",
+				"# 0.0.0.0 b.com",
+				"# 0.0.0.0 c.com",
+			),
+			pruned: 2,
+		},
+		{
+			name:    "prune comment managed",
+			mode:    modeFull,
+			managed: true,
+			prune:   pruneComment,
+			in:      []string{"0.0.0.0 a.com", "0.0.0.0 b.com c.com"},
+			dead:    map[string]bool{"0.0.0.0 b.com c.com": true},
+			want: lines(
+				"0.0.0.0 a.com",
+				"# 0.0.0.0 b.com c.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+			),
+			pruned: 2,
+		},
+		{
+			name:    "prune remove managed",
+			mode:    modeFull,
+			managed: true,
+			prune:   pruneRemove,
+			in:      []string{"0.0.0.0 a.com", "0.0.0.0 b.com c.com"},
+			dead:    map[string]bool{"0.0.0.0 b.com c.com": true},
+			want: lines(
+				"0.0.0.0 a.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+			),
+			pruned: 2,
+		},
+		{
+			name:    "prune changed managed",
+			mode:    modeChanged,
+			managed: true,
+			prune:   pruneComment,
+			in:      []string{"0.0.0.0 a.com", "0.0.0.0 b.com"},
+			dead:    map[string]bool{"0.0.0.0 b.com": true},
+			want: lines(
+				"# 0.0.0.0 b.com",
+				hosts.BeginManaged,
+				"0.0.0.0 www.a.com",
+				hosts.EndManaged,
+			),
+			pruned: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w strings.Builder
+
+			o := newOutput(&w, tt.mode, "hosts")
+			o.managed = tt.managed
+			o.prune = tt.prune
+
+			got, pruned, open := write(t, o, &w, tt.in, adds, tt.dead)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.pruned, pruned)
+			assert.Equal(t, tt.open, open)
+		})
+	}
+}
+
+func TestOutputConverges(t *testing.T) {
+	adds := map[string][]string{
+		"0.0.0.0 a.com": {"0.0.0.0 www.a.com"},
+		"0.0.0.0 b.com": {"0.0.0.0 www.b.com"},
+	}
+
+	in := []string{"# hosts", "0.0.0.0 a.com", "", "0.0.0.0 b.com"}
+
+	var first, second, d strings.Builder
+
+	o := newOutput(&first, modeFull, "hosts")
+	o.managed = true
+
+	out, _, _ := write(t, o, &first, in, adds, nil)
+
+	again := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+
+	o = newOutput(&second, modeFull, "hosts")
+	o.managed = true
+
+	got, _, _ := write(t, o, &second, again, adds, nil)
+
+	assert.Equal(t, out, got)
+
+	o = newOutput(&d, modeDiff, "hosts")
+	o.managed = true
+
+	got, _, _ = write(t, o, &d, again, adds, nil)
+
+	assert.Empty(t, got)
+}
@@ -0,0 +1,180 @@
+// Package atomicfile replaces a file atomically, so that readers see either
+// the old or the new content and an interrupted write leaves the file intact.
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrDone is returned when a File is committed or aborted twice.
+var ErrDone = errors.New("file already committed or aborted")
+
+// File is a temporary file in the directory of the file it replaces.
+type File struct {
+	*os.File
+	path string
+	done bool
+}
+
+// Create returns a File replacing path on Commit, with the permissions and
+// owner of path if it exists, or readable by everyone otherwise. A symbolic
+// link is kept and the file it points to is replaced.
+func Create(path string) (*File, error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(
+		filepath.Dir(path),
+		"."+filepath.Base(path)+".*.tmp",
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{File: tmp, path: path}
+
+	if fi != nil {
+		err = tmp.Chmod(fi.Mode().Perm())
+
+		if err == nil {
+			err = chown(tmp, fi)
+		}
+	} else {
+		err = tmp.Chmod(0o644)
+	}
+
+	if err != nil {
+		f.Abort()
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Commit syncs the file and renames it over the file it replaces, keeping
+// the old file with the suffix backup unless backup is empty.
+func (f *File) Commit(backup string) error {
+	if f.done {
+		return ErrDone
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Abort()
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		f.Abort()
+
+		return err
+	}
+
+	f.done = true
+
+	if backup != "" {
+		if err := link(f.path, f.path+backup); err != nil {
+			os.Remove(f.Name())
+
+			return err
+		}
+	}
+
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(f.path))
+
+	if err != nil {
+		return err
+	}
+
+	defer dir.Close()
+
+	// Not every platform can sync a directory.
+	if err := dir.Sync(); err != nil && !errors.Is(err, fs.ErrInvalid) {
+		return err
+	}
+
+	return nil
+}
+
+// Abort removes the file, leaving the file it replaces untouched. It does
+// nothing after Commit.
+func (f *File) Abort() error {
+	if f.done {
+		return nil
+	}
+
+	f.done = true
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+// link makes dst a link to src, or a copy if links are not supported,
+// replacing dst. Nothing is done if src does not exist.
+func link(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err := os.Link(src, dst)
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	}
+
+	in, err := os.Open(src)
+
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	fi, err := in.Stat()
+
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(
+		dst,
+		os.O_WRONLY|os.O_CREATE|os.O_EXCL,
+		fi.Mode().Perm(),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+
+		return err
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,139 @@
+package atomicfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/atomicfile"
+)
+
+// names lists the files of dir.
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+
+	ents, err := os.ReadDir(dir)
+
+	assert.NoError(t, err)
+
+	var ns []string
+
+	for _, e := range ents {
+		ns = append(ns, e.Name())
+	}
+
+	return ns
+}
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+
+	assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0o640))
+	assert.NoError(t, os.Chmod(path, 0o640))
+
+	f, err := atomicfile.Create(path)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = f.WriteString("new\n")
+	assert.NoError(t, err)
+
+	// The file is untouched until committed.
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "old\n", string(b))
+
+	assert.NoError(t, f.Commit(".bak"))
+	assert.ErrorIs(t, f.Commit(".bak"), atomicfile.ErrDone)
+
+	b, _ = os.ReadFile(path)
+	assert.Equal(t, "new\n", string(b))
+
+	b, _ = os.ReadFile(path + ".bak")
+	assert.Equal(t, "old\n", string(b))
+
+	fi, err := os.Stat(path)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+	}
+
+	assert.Equal(t, []string{"hosts", "hosts.bak"}, names(t, dir))
+}
+
+func TestCommitNew(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+
+	f, err := atomicfile.Create(path)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = f.WriteString("new\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Commit(".bak"))
+
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "new\n", string(b))
+	assert.Equal(t, []string{"hosts"}, names(t, dir))
+}
+
+func TestAbort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+
+	assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0o644))
+
+	f, err := atomicfile.Create(path)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = f.WriteString("partial")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Abort())
+	assert.NoError(t, f.Abort())
+	assert.ErrorIs(t, f.Commit(""), atomicfile.ErrDone)
+
+	b, _ := os.ReadFile(path)
+	assert.Equal(t, "old\n", string(b))
+	assert.Equal(t, []string{"hosts"}, names(t, dir))
+}
+
+func TestCommitSymlink(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "hosts")
+	target := filepath.Join(dir, "hosts.real")
+
+	assert.NoError(t, os.WriteFile(target, []byte("old\n"), 0o644))
+	assert.NoError(t, os.Symlink("hosts.real", path))
+
+	f, err := atomicfile.Create(path)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = f.WriteString("new\n")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Commit(".bak"))
+
+	b, _ := os.ReadFile(target)
+	assert.Equal(t, "new\n", string(b))
+
+	dst, err := os.Readlink(path)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "hosts.real", dst)
+	}
+
+	b, _ = os.ReadFile(target + ".bak")
+	assert.Equal(t, "old\n", string(b))
+}
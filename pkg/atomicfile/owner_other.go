@@ -0,0 +1,10 @@
+//go:build !unix
+
+package atomicfile
+
+import "os"
+
+// chown does nothing where files have no owner.
+func chown(*os.File, os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package atomicfile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// chown gives f the owner and group of fi. Only the superuser may give a
+// file away, so otherwise f keeps the group if the user is in it, and the
+// user as the owner.
+func chown(f *os.File, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+
+	if !ok {
+		return nil
+	}
+
+	if int(st.Uid) == os.Getuid() && int(st.Gid) == os.Getgid() {
+		return nil
+	}
+
+	err := f.Chown(int(st.Uid), int(st.Gid))
+
+	if errors.Is(err, fs.ErrPermission) {
+		f.Chown(-1, int(st.Gid))
+
+		return nil
+	}
+
+	return err
+}
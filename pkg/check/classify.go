@@ -0,0 +1,144 @@
+// Package check classifies the names of a hosts block list.
+package check
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// Class is the classification of a response.
+type Class string
+
+// Classes of responses.
+const (
+	// Resolves is a name answered with data.
+	Resolves Class = "resolves"
+	// Filtered is a name answered only with sinkhole addresses.
+	Filtered Class = "filtered"
+	// NXDomain is a name that does not exist.
+	NXDomain Class = "nxdomain"
+	// Failed is a name answered with any other rcode.
+	Failed Class = "failed"
+	// Error is a name without a response.
+	Error Class = "error"
+)
+
+// DefaultSinkholes are the addresses returned for blocked names by common
+// filtering resolvers.
+const DefaultSinkholes = "0.0.0.0/32,127.0.0.0/8,::/128,::1/128"
+
+// DefaultCanary is a name blocked by virtually every block list.
+const DefaultCanary = "ad.doubleclick.net"
+
+// Sinkholes is a set of addresses returned for blocked names.
+type Sinkholes []netip.Prefix
+
+// ParseSinkholes parses a comma separated list of addresses and CIDR blocks.
+func ParseSinkholes(list string) (Sinkholes, error) {
+	var s Sinkholes
+
+	for _, fld := range strings.Split(list, ",") {
+		fld = strings.TrimSpace(fld)
+
+		if fld == "" {
+			continue
+		}
+
+		if !strings.Contains(fld, "/") {
+			addr, err := netip.ParseAddr(fld)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid sinkhole %q: %w", fld, err)
+			}
+
+			s = append(s, netip.PrefixFrom(addr, addr.BitLen()))
+
+			continue
+		}
+
+		pfx, err := netip.ParsePrefix(fld)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid sinkhole %q: %w", fld, err)
+		}
+
+		s = append(s, pfx.Masked())
+	}
+
+	return s, nil
+}
+
+// Contains reports whether addr is a sinkhole address.
+func (s Sinkholes) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, pfx := range s {
+		if pfx.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Classify classifies a response. A response is filtered if every address
+// in its answer is a sinkhole address.
+func Classify(m *dns.Msg, s Sinkholes) Class {
+	switch m.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		return NXDomain
+	default:
+		return Failed
+	}
+
+	sinkholed := false
+
+	for _, rr := range m.Answer {
+		var addr netip.Addr
+
+		switch rr := rr.(type) {
+		case *dns.A:
+			addr, _ = netip.AddrFromSlice(rr.A)
+		case *dns.AAAA:
+			addr, _ = netip.AddrFromSlice(rr.AAAA)
+		default:
+			continue
+		}
+
+		if !s.Contains(addr) {
+			return Resolves
+		}
+
+		sinkholed = true
+	}
+
+	if sinkholed {
+		return Filtered
+	}
+
+	return Resolves
+}
+
+// IsFiltering queries r for a canary name blocked by virtually every block
+// list and reports whether r answers it with a sinkhole address or NXDOMAIN,
+// as the canary exists.
+func IsFiltering(r resolver.Resolver, canary string, s Sinkholes) (bool, error) {
+	res, err := r.Resolve(canary, dns.TypeA)
+
+	if err != nil {
+		return false, err
+	}
+
+	switch Classify(res.Msg, s) {
+	case Filtered, NXDomain:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
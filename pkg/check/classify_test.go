@@ -0,0 +1,175 @@
+package check_test
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// reply builds a response with rcode and the answer records.
+func reply(rcode int, answer ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.Response = true
+	m.Rcode = rcode
+
+	for _, s := range answer {
+		rr, _ := dns.NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+
+	return m
+}
+
+// stub is a Resolver answering every query with msg.
+type stub struct {
+	msg *dns.Msg
+}
+
+func (s stub) Resolve(string, uint16) (*resolver.Result, error) {
+	return &resolver.Result{Msg: s.msg}, nil
+}
+
+func TestParseSinkholes(t *testing.T) {
+	s, err := check.ParseSinkholes("0.0.0.0, 10.1.2.3/8,::1")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, check.Sinkholes{
+			netip.MustParsePrefix("0.0.0.0/32"),
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("::1/128"),
+		}, s)
+	}
+
+	_, err = check.ParseSinkholes("0.0.0.0,blocked")
+	assert.Error(t, err)
+
+	_, err = check.ParseSinkholes("10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestSinkholesContains(t *testing.T) {
+	s, _ := check.ParseSinkholes(check.DefaultSinkholes)
+
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"0.0.0.0", true},
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"192.0.2.1", false},
+		{"2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, s.Contains(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	s, _ := check.ParseSinkholes(check.DefaultSinkholes + ",198.51.100.7")
+
+	tests := []struct {
+		name string
+		msg  *dns.Msg
+		want check.Class
+	}{
+		{
+			name: "resolves",
+			msg:  reply(dns.RcodeSuccess, "example.com. 60 IN A 192.0.2.1"),
+			want: check.Resolves,
+		},
+		{
+			name: "noData",
+			msg:  reply(dns.RcodeSuccess),
+			want: check.Resolves,
+		},
+		{
+			name: "unspecified",
+			msg:  reply(dns.RcodeSuccess, "example.com. 60 IN A 0.0.0.0"),
+			want: check.Filtered,
+		},
+		{
+			name: "unspecifiedIPv6",
+			msg:  reply(dns.RcodeSuccess, "example.com. 60 IN AAAA ::"),
+			want: check.Filtered,
+		},
+		{
+			name: "blockPage",
+			msg: reply(
+				dns.RcodeSuccess,
+				"example.com. 60 IN CNAME block.example.net.",
+				"block.example.net. 60 IN A 198.51.100.7",
+			),
+			want: check.Filtered,
+		},
+		{
+			name: "mixed",
+			msg: reply(
+				dns.RcodeSuccess,
+				"example.com. 60 IN A 127.0.0.1",
+				"example.com. 60 IN A 192.0.2.1",
+			),
+			want: check.Resolves,
+		},
+		{
+			name: "nxdomain",
+			msg:  reply(dns.RcodeNameError),
+			want: check.NXDomain,
+		},
+		{
+			name: "servfail",
+			msg:  reply(dns.RcodeServerFailure),
+			want: check.Failed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, check.Classify(tt.msg, s))
+		})
+	}
+}
+
+func TestIsFiltering(t *testing.T) {
+	s, _ := check.ParseSinkholes(check.DefaultSinkholes)
+
+	got, err := check.IsFiltering(
+		stub{reply(dns.RcodeSuccess, "example.com. 60 IN A 0.0.0.0")},
+		check.DefaultCanary,
+		s,
+	)
+
+	if assert.NoError(t, err) {
+		assert.True(t, got)
+	}
+
+	got, err = check.IsFiltering(
+		stub{reply(dns.RcodeNameError)},
+		check.DefaultCanary,
+		s,
+	)
+
+	if assert.NoError(t, err) {
+		assert.True(t, got)
+	}
+
+	got, err = check.IsFiltering(
+		stub{reply(dns.RcodeSuccess, "example.com. 60 IN A 192.0.2.1")},
+		check.DefaultCanary,
+		s,
+	)
+
+	if assert.NoError(t, err) {
+		assert.False(t, got)
+	}
+}
@@ -0,0 +1,127 @@
+package check
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/mys721tx/lpc/pkg/atomicfile"
+)
+
+// Streak is the run of consecutive checks an entry was dead.
+type Streak struct {
+	Name string `json:"name"`
+	Runs int    `json:"runs"`
+	// Since is the time of the first check of the streak.
+	Since time.Time `json:"since"`
+}
+
+// History keeps the streaks of the dead entries between runs. An entry is
+// dead if it does not exist; an answer with data ends the streak, and an
+// error leaves it unchanged.
+type History struct {
+	streaks map[string]*Streak
+	seen    map[string]bool
+}
+
+// NewHistory returns an empty History.
+func NewHistory() *History {
+	return &History{
+		streaks: make(map[string]*Streak),
+		seen:    make(map[string]bool),
+	}
+}
+
+// LoadHistory reads a History from path, a JSON document on each line. A
+// missing file is an empty History.
+func LoadHistory(path string) (*History, error) {
+	h := NewHistory()
+
+	f, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	scn := bufio.NewScanner(f)
+
+	for scn.Scan() {
+		var s Streak
+
+		if err := json.Unmarshal(scn.Bytes(), &s); err != nil {
+			return nil, err
+		}
+
+		h.streaks[s.Name] = &s
+	}
+
+	return h, scn.Err()
+}
+
+// Observe records the class of the entry name checked at now and returns the
+// number of consecutive runs it was dead.
+func (h *History) Observe(name string, cls Class, now time.Time) int {
+	h.seen[name] = true
+
+	s := h.streaks[name]
+
+	switch cls {
+	case NXDomain:
+		if s == nil {
+			s = &Streak{Name: name, Since: now}
+			h.streaks[name] = s
+		}
+
+		s.Runs++
+	case Resolves, Filtered:
+		delete(h.streaks, name)
+
+		return 0
+	}
+
+	if s == nil {
+		return 0
+	}
+
+	return s.Runs
+}
+
+// Save writes the streaks of the entries observed to path atomically. The
+// entries no longer checked are forgotten.
+func (h *History) Save(path string) error {
+	f, err := atomicfile.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	for name, s := range h.streaks {
+		if !h.seen[name] {
+			continue
+		}
+
+		if err := enc.Encode(s); err != nil {
+			f.Abort()
+
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Abort()
+
+		return err
+	}
+
+	return f.Commit("")
+}
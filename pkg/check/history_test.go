@@ -0,0 +1,85 @@
+package check_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	runs := []struct {
+		name    string
+		classes map[string]check.Class
+		want    map[string]int
+	}{
+		{
+			name: "first",
+			classes: map[string]check.Class{
+				"dead.com":  check.NXDomain,
+				"back.com":  check.NXDomain,
+				"flaky.com": check.NXDomain,
+				"gone.com":  check.NXDomain,
+			},
+			want: map[string]int{
+				"dead.com":  1,
+				"back.com":  1,
+				"flaky.com": 1,
+				"gone.com":  1,
+			},
+		},
+		{
+			name: "second",
+			classes: map[string]check.Class{
+				"dead.com":  check.NXDomain,
+				"back.com":  check.Resolves,
+				"flaky.com": check.Error,
+				"new.com":   check.Failed,
+			},
+			want: map[string]int{
+				"dead.com":  2,
+				"back.com":  0,
+				"flaky.com": 1,
+				"new.com":   0,
+			},
+		},
+		{
+			name: "third",
+			classes: map[string]check.Class{
+				"dead.com":  check.NXDomain,
+				"back.com":  check.NXDomain,
+				"flaky.com": check.NXDomain,
+				"gone.com":  check.NXDomain,
+			},
+			want: map[string]int{
+				"dead.com":  3,
+				"back.com":  1,
+				"flaky.com": 2,
+				"gone.com":  1,
+			},
+		},
+	}
+	for i, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			h, err := check.LoadHistory(path)
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			at := now.Add(time.Duration(i) * 24 * time.Hour)
+
+			for name, cls := range run.classes {
+				assert.Equal(t, run.want[name], h.Observe(name, cls, at), name)
+			}
+
+			assert.NoError(t, h.Save(path))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package check
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+// Candidate is a query sent for an entry of a hosts file.
+type Candidate struct {
+	Name  string
+	Qtype uint16
+	// From is the entry the name is derived from.
+	From string
+}
+
+// Prefixed reports whether the candidate is a prefixed name rather than the
+// entry itself.
+func (c Candidate) Prefixed() bool {
+	return c.Name != c.From
+}
+
+// Planner lists the candidates of the lines of a hosts file in the order
+// they are queried. Each entry is queried once, and each prefixed name once
+// unless it is an entry, and special names are never queried. An entry is
+// queried even if it was queried as a prefixed name, as its result is
+// written differently.
+type Planner struct {
+	Prefix string
+	// Special and Duplicates count the names skipped.
+	Special, Duplicates int
+
+	entries, prefixed map[string]bool
+}
+
+// NewPlanner returns a Planner prefixing the entries with prefix.
+func NewPlanner(prefix string) *Planner {
+	return &Planner{
+		Prefix:   prefix,
+		entries:  make(map[string]bool),
+		prefixed: make(map[string]bool),
+	}
+}
+
+// Line returns the candidates for the hostnames of a line: the hostnames,
+// then their prefixed names.
+func (p *Planner) Line(hns []string) []Candidate {
+	var cands []Candidate
+
+	for _, dom := range hns {
+		cands = p.add(cands, dom, dom)
+	}
+
+	for _, dom := range hns {
+		cands = p.add(cands, p.Prefix+dom, dom)
+	}
+
+	return cands
+}
+
+// add appends the candidate for name unless it is skipped.
+func (p *Planner) add(cands []Candidate, name, from string) []Candidate {
+	c := Candidate{Name: name, Qtype: dns.TypeA, From: from}
+	seen := p.entries
+
+	if c.Prefixed() {
+		seen = p.prefixed
+	}
+
+	switch {
+	case p.entries[name] || seen[name]:
+		p.Duplicates++
+	case hosts.IsSpecial(name):
+		p.Special++
+	default:
+		cands = append(cands, c)
+	}
+
+	seen[name] = true
+
+	return cands
+}
@@ -0,0 +1,92 @@
+package check_test
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+)
+
+func TestPlanner(t *testing.T) {
+	p := check.NewPlanner("www.")
+
+	tests := []struct {
+		name  string
+		hns   []string
+		cands []check.Candidate
+	}{
+		{
+			name: "entry",
+			hns:  []string{"a.com"},
+			cands: []check.Candidate{
+				{Name: "a.com", Qtype: dns.TypeA, From: "a.com"},
+				{Name: "www.a.com", Qtype: dns.TypeA, From: "a.com"},
+			},
+		},
+		{
+			name: "special",
+			hns:  []string{"localhost", "b.com"},
+			cands: []check.Candidate{
+				{Name: "b.com", Qtype: dns.TypeA, From: "b.com"},
+				{Name: "www.b.com", Qtype: dns.TypeA, From: "b.com"},
+			},
+		},
+		{
+			name: "prefixed entry",
+			hns:  []string{"www.a.com", "c.com"},
+			cands: []check.Candidate{
+				{Name: "www.a.com", Qtype: dns.TypeA, From: "www.a.com"},
+				{Name: "c.com", Qtype: dns.TypeA, From: "c.com"},
+				{Name: "www.www.a.com", Qtype: dns.TypeA, From: "www.a.com"},
+				{Name: "www.c.com", Qtype: dns.TypeA, From: "c.com"},
+			},
+		},
+		{
+			name: "entry of prefixed",
+			hns:  []string{"d.com", "www.d.com"},
+			cands: []check.Candidate{
+				{Name: "d.com", Qtype: dns.TypeA, From: "d.com"},
+				{Name: "www.d.com", Qtype: dns.TypeA, From: "www.d.com"},
+				{Name: "www.www.d.com", Qtype: dns.TypeA, From: "www.d.com"},
+			},
+		},
+		{
+			name: "prefixed",
+			hns:  []string{"e.com"},
+			cands: []check.Candidate{
+				{Name: "e.com", Qtype: dns.TypeA, From: "e.com"},
+				{Name: "www.e.com", Qtype: dns.TypeA, From: "e.com"},
+			},
+		},
+		{
+			name: "later entry of prefixed",
+			hns:  []string{"www.e.com"},
+			cands: []check.Candidate{
+				{Name: "www.e.com", Qtype: dns.TypeA, From: "www.e.com"},
+				{Name: "www.www.e.com", Qtype: dns.TypeA, From: "www.e.com"},
+			},
+		},
+		{
+			name:  "duplicate prefixed entry",
+			hns:   []string{"www.a.com"},
+			cands: nil,
+		},
+		{
+			name:  "duplicate",
+			hns:   []string{"a.com"},
+			cands: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.cands, p.Line(tt.hns))
+		})
+	}
+
+	assert.Equal(t, 2, p.Special)
+	assert.Equal(t, 5, p.Duplicates)
+	assert.False(t, check.Candidate{Name: "a.com", From: "a.com"}.Prefixed())
+	assert.True(t, check.Candidate{Name: "www.a.com", From: "a.com"}.Prefixed())
+}
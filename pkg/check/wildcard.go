@@ -0,0 +1,24 @@
+package check
+
+import (
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// WildcardLabel is the label queried under a name to detect a wildcard. It
+// is fixed so that the probes can be recorded, cached and replayed.
+const WildcardLabel = "lpc-wildcard-check"
+
+// IsWildcard queries r for a name that should not exist under name and
+// reports whether it resolves, so that every name under name is answered by
+// a wildcard.
+func IsWildcard(r resolver.Resolver, name string, s Sinkholes) (bool, error) {
+	res, err := r.Resolve(WildcardLabel+"."+name, dns.TypeA)
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(res.Msg.Answer) > 0 && Classify(res.Msg, s) == Resolves, nil
+}
@@ -0,0 +1,50 @@
+package check_test
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+)
+
+func TestIsWildcard(t *testing.T) {
+	s, _ := check.ParseSinkholes(check.DefaultSinkholes)
+
+	tests := []struct {
+		name string
+		msg  *dns.Msg
+		want bool
+	}{
+		{
+			name: "wildcard",
+			msg:  reply(dns.RcodeSuccess, "example.com. 60 IN A 192.0.2.1"),
+			want: true,
+		},
+		{
+			name: "nxdomain",
+			msg:  reply(dns.RcodeNameError),
+			want: false,
+		},
+		{
+			name: "nodata",
+			msg:  reply(dns.RcodeSuccess),
+			want: false,
+		},
+		{
+			name: "sinkholed",
+			msg:  reply(dns.RcodeSuccess, "example.com. 60 IN A 0.0.0.0"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := check.IsWildcard(stub{tt.msg}, "ads.example.com", s)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+// Package diff writes the changes of a rewritten file as a unified diff.
+package diff
+
+import (
+	"fmt"
+	"io"
+)
+
+// Context is the number of unchanged lines around each hunk.
+const Context = 3
+
+// hunk is a group of changes with their context.
+type hunk struct {
+	oldStart, newStart int
+	oldN, newN         int
+	lines              []string
+	// trailing is the number of unchanged lines at the end.
+	trailing int
+}
+
+// Unified writes a unified diff of a file rewritten a line at a time, each
+// line of the old file replaced by zero or more lines of the new file. Hunks
+// are written as soon as they end, so the files are never held in memory.
+type Unified struct {
+	OldName, NewName string
+
+	w        io.Writer
+	err      error
+	header   bool
+	old, new int
+	// before are the last unchanged lines outside of a hunk.
+	before []string
+	hunk   *hunk
+}
+
+// NewUnified returns a Unified writing to w.
+func NewUnified(w io.Writer, oldName, newName string) *Unified {
+	return &Unified{OldName: oldName, NewName: newName, w: w, old: 1, new: 1}
+}
+
+// Line records that the line old of the old file is replaced by the lines
+// new. Lines following old unchanged are insertions.
+func (u *Unified) Line(old string, new []string) {
+	if len(new) > 0 && new[0] == old {
+		u.same(old)
+		u.Insert(new[1:])
+
+		return
+	}
+
+	u.change(&old, new)
+}
+
+// Insert records the lines new inserted after the last line.
+func (u *Unified) Insert(new []string) {
+	if len(new) > 0 {
+		u.change(nil, new)
+	}
+}
+
+// same records an unchanged line.
+func (u *Unified) same(line string) {
+	u.old++
+	u.new++
+
+	h := u.hunk
+
+	if h == nil {
+		u.before = append(u.before, line)
+
+		if len(u.before) > Context {
+			u.before = u.before[1:]
+		}
+
+		return
+	}
+
+	h.lines = append(h.lines, " "+line)
+	h.oldN++
+	h.newN++
+	h.trailing++
+
+	if h.trailing > 2*Context {
+		// The next change is too far to share the context.
+		keep := len(h.lines) - h.trailing + Context
+
+		u.before = append([]string(nil), h.lines[len(h.lines)-Context:]...)
+
+		for i := range u.before {
+			u.before[i] = u.before[i][1:]
+		}
+
+		h.oldN -= h.trailing - Context
+		h.newN -= h.trailing - Context
+		h.lines = h.lines[:keep]
+
+		u.flush()
+	}
+}
+
+// change records old, if any, replaced by the lines new.
+func (u *Unified) change(old *string, new []string) {
+	h := u.hunk
+
+	if h == nil {
+		h = &hunk{
+			oldStart: u.old - len(u.before),
+			newStart: u.new - len(u.before),
+			oldN:     len(u.before),
+			newN:     len(u.before),
+		}
+
+		for _, line := range u.before {
+			h.lines = append(h.lines, " "+line)
+		}
+
+		u.before = nil
+		u.hunk = h
+	}
+
+	if old != nil {
+		h.lines = append(h.lines, "-"+*old)
+		h.oldN++
+		u.old++
+	}
+
+	for _, line := range new {
+		h.lines = append(h.lines, "+"+line)
+	}
+
+	h.newN += len(new)
+	h.trailing = 0
+	u.new += len(new)
+}
+
+// flush writes the current hunk.
+func (u *Unified) flush() {
+	h := u.hunk
+	u.hunk = nil
+
+	if u.err != nil {
+		return
+	}
+
+	if !u.header {
+		u.header = true
+
+		_, u.err = fmt.Fprintf(u.w, "--- %s\n+++ %s\n", u.OldName, u.NewName)
+
+		if u.err != nil {
+			return
+		}
+	}
+
+	_, u.err = fmt.Fprintf(
+		u.w,
+		"@@ -%s +%s @@\n",
+		span(h.oldStart, h.oldN),
+		span(h.newStart, h.newN),
+	)
+
+	for _, line := range h.lines {
+		if u.err != nil {
+			return
+		}
+
+		_, u.err = fmt.Fprintln(u.w, line)
+	}
+}
+
+// span formats the range of a hunk, an empty range starting at the line
+// before it.
+func span(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	default:
+		return fmt.Sprintf("%d,%d", start, n)
+	}
+}
+
+// Close writes the last hunk and returns the first error writing the diff.
+// Nothing is written if the files are identical.
+func (u *Unified) Close() error {
+	if u.hunk != nil {
+		u.flush()
+	}
+
+	return u.err
+}
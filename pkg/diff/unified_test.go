@@ -0,0 +1,166 @@
+package diff_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/diff"
+)
+
+// apply applies the unified diff d to the lines old.
+func apply(t *testing.T, old []string, d string) []string {
+	t.Helper()
+
+	var out []string
+
+	next := 0
+	lines := strings.Split(strings.TrimSuffix(d, "\n"), "\n")
+
+	for _, l := range lines {
+		switch {
+		case d == "":
+		case strings.HasPrefix(l, "--- "), strings.HasPrefix(l, "+++ "):
+		case strings.HasPrefix(l, "@@ "):
+			var start int
+
+			fmt.Sscanf(strings.TrimPrefix(l, "@@ -"), "%d", &start)
+
+			if strings.HasPrefix(l, "@@ -"+strconv.Itoa(start)+",0 ") {
+				start++
+			}
+
+			for ; next < start-1; next++ {
+				out = append(out, old[next])
+			}
+		case strings.HasPrefix(l, " "):
+			assert.Equal(t, old[next], l[1:])
+			out = append(out, l[1:])
+			next++
+		case strings.HasPrefix(l, "-"):
+			assert.Equal(t, old[next], l[1:])
+			next++
+		case strings.HasPrefix(l, "+"):
+			out = append(out, l[1:])
+		default:
+			t.Fatalf("invalid line %q", l)
+		}
+	}
+
+	return append(out, old[next:]...)
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []string
+		new  [][]string
+		want string
+	}{
+		{
+			name: "unchanged",
+			old:  []string{"a", "b"},
+			new:  [][]string{{"a"}, {"b"}},
+			want: "",
+		},
+		{
+			name: "insert",
+			old:  []string{"a", "b", "c", "d", "e"},
+			new:  [][]string{{"a"}, {"b"}, {"c"}, {"d", "d1", "d2"}, {"e"}},
+			want: "--- old\n+++ new\n@@ -2,4 +2,6 @@\n b\n c\n d\n+d1\n+d2\n e\n",
+		},
+		{
+			name: "replace",
+			old:  []string{"a", "b"},
+			new:  [][]string{{"a1", "a2"}, {}},
+			want: "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-a\n+a1\n+a2\n-b\n",
+		},
+		{
+			name: "hunks",
+			old:  strings.Split("a b c d e f g h i j k l", " "),
+			new: [][]string{
+				{"A"}, {"b"}, {"c"}, {"d"}, {"e"}, {"f"}, {"g"}, {"h"},
+				{"i"}, {"j"}, {"k"}, {"l", "m"},
+			},
+			want: "--- old\n+++ new\n" +
+				"@@ -1,4 +1,4 @@\n-a\n+A\n b\n c\n d\n" +
+				"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n",
+		},
+		{
+			name: "merged",
+			old:  strings.Split("a b c d e f g h", " "),
+			new: [][]string{
+				{"A"}, {"b"}, {"c"}, {"d"}, {"e"}, {"f"}, {"g"}, {"H"},
+			},
+			want: "--- old\n+++ new\n" +
+				"@@ -1,8 +1,8 @@\n-a\n+A\n b\n c\n d\n e\n f\n g\n-h\n+H\n",
+		},
+		{
+			name: "append",
+			old:  []string{"a", "b", "c", "d"},
+			new:  [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e", "f"}},
+			want: "--- old\n+++ new\n@@ -2,3 +2,5 @@\n b\n c\n d\n+e\n+f\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			u := diff.NewUnified(&buf, "old", "new")
+
+			for i, l := range tt.old {
+				u.Line(l, tt.new[i])
+			}
+
+			if len(tt.new) > len(tt.old) {
+				u.Insert(tt.new[len(tt.old)])
+			}
+
+			assert.NoError(t, u.Close())
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestUnifiedApply(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for n := range 200 {
+		var (
+			buf      bytes.Buffer
+			old, new []string
+		)
+
+		u := diff.NewUnified(&buf, "old", "new")
+
+		for i := range rng.IntN(40) {
+			l := fmt.Sprintf("line %d", i)
+			old = append(old, l)
+
+			var repl []string
+
+			switch rng.IntN(6) {
+			case 0:
+			case 1:
+				repl = []string{l + " changed"}
+			case 2:
+				repl = []string{l, fmt.Sprintf("added %d", i)}
+			case 3:
+				repl = []string{"split " + l, "split again " + l}
+			default:
+				repl = []string{l}
+			}
+
+			u.Line(l, repl)
+			new = append(new, repl...)
+		}
+
+		assert.NoError(t, u.Close())
+		assert.Equal(t, new, apply(t, old, buf.String()), "case %d", n)
+	}
+}
@@ -0,0 +1,557 @@
+// Package dnssec determines the DNSSEC validation status of a response.
+package dnssec
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// Status is the DNSSEC validation status of a response.
+type Status string
+
+// Validation statuses, see RFC 4033 section 5.
+const (
+	// Secure is a response validated up to a trust anchor.
+	Secure Status = "secure"
+	// Insecure is a response from a zone proven to be unsigned.
+	Insecure Status = "insecure"
+	// Bogus is a response that fails validation.
+	Bogus Status = "bogus"
+	// Indeterminate is a response whose status cannot be determined.
+	Indeterminate Status = "indeterminate"
+)
+
+// FromAD returns the status reported by a validating upstream in the AD bit.
+func FromAD(m *dns.Msg) Status {
+	if m.AuthenticatedData {
+		return Secure
+	}
+
+	return Insecure
+}
+
+// LoadAnchors reads trust anchors as DS or DNSKEY records in the zone file
+// format, such as the root.key file of Unbound.
+func LoadAnchors(path string) ([]dns.RR, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var anchors []dns.RR
+
+	zp := dns.NewZoneParser(f, ".", path)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr.(type) {
+		case *dns.DS, *dns.DNSKEY:
+			anchors = append(anchors, rr)
+		default:
+			return nil, fmt.Errorf(
+				"%s: %s is not a trust anchor",
+				path,
+				dns.TypeToString[rr.Header().Rrtype],
+			)
+		}
+	}
+
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(anchors) == 0 {
+		return nil, fmt.Errorf("%s: no trust anchor", path)
+	}
+
+	return anchors, nil
+}
+
+// keySet is the DNSKEY RRset of a zone with its status.
+type keySet struct {
+	keys   []*dns.DNSKEY
+	status Status
+}
+
+// Validator validates responses locally from trust anchors. The Resolver
+// must request DNSSEC records with validation disabled on the upstream.
+//
+// A zone without a DS record is insecure only if its parent is, or if the
+// parent proves the absence with signed NSEC or NSEC3 records. A Validator
+// caches the keys of each zone and is not safe for concurrent use.
+type Validator struct {
+	Resolver resolver.Resolver
+	// Now returns the time the signatures are checked against.
+	Now func() time.Time
+
+	anchors map[string][]dns.RR
+	zones   map[string]*keySet
+}
+
+// NewValidator returns a Validator querying r for the keys and trusting the
+// anchors.
+func NewValidator(r resolver.Resolver, anchors []dns.RR) *Validator {
+	v := &Validator{
+		Resolver: r,
+		Now:      time.Now,
+		anchors:  make(map[string][]dns.RR),
+		zones:    make(map[string]*keySet),
+	}
+
+	for _, rr := range anchors {
+		zone := dns.CanonicalName(rr.Header().Name)
+		v.anchors[zone] = append(v.anchors[zone], rr)
+	}
+
+	return v
+}
+
+// rrset is the records sharing an owner name and type with their
+// signatures.
+type rrset struct {
+	rrs  []dns.RR
+	sigs []*dns.RRSIG
+}
+
+// group splits records to RRsets.
+func group(rrs []dns.RR) []*rrset {
+	var sets []*rrset
+	idx := make(map[string]*rrset)
+
+	key := func(name string, t uint16) string {
+		return dns.CanonicalName(name) + "/" + dns.TypeToString[t]
+	}
+
+	for _, rr := range rrs {
+		if _, ok := rr.(*dns.RRSIG); ok {
+			continue
+		}
+
+		k := key(rr.Header().Name, rr.Header().Rrtype)
+
+		if set, ok := idx[k]; ok {
+			set.rrs = append(set.rrs, rr)
+		} else {
+			idx[k] = &rrset{rrs: []dns.RR{rr}}
+			sets = append(sets, idx[k])
+		}
+	}
+
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if set, ok := idx[key(sig.Hdr.Name, sig.TypeCovered)]; ok {
+				set.sigs = append(set.sigs, sig)
+			}
+		}
+	}
+
+	return sets
+}
+
+// worst combines two statuses.
+func worst(a, b Status) Status {
+	for _, s := range []Status{Bogus, Indeterminate, Insecure} {
+		if a == s || b == s {
+			return s
+		}
+	}
+
+	return Secure
+}
+
+// Validate returns the status of a response. The answer and the denial of
+// existence in the authority section are validated.
+func (v *Validator) Validate(m *dns.Msg) (Status, error) {
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return Indeterminate, nil
+	}
+
+	rrs := append([]dns.RR(nil), m.Answer...)
+
+	for _, rr := range m.Ns {
+		switch rr.Header().Rrtype {
+		case dns.TypeSOA, dns.TypeNSEC, dns.TypeNSEC3, dns.TypeRRSIG:
+			rrs = append(rrs, rr)
+		}
+	}
+
+	sets := group(rrs)
+
+	if len(sets) == 0 {
+		return Indeterminate, nil
+	}
+
+	status := Secure
+
+	for _, set := range sets {
+		s, err := v.verify(set)
+
+		if err != nil {
+			return Indeterminate, err
+		}
+
+		status = worst(status, s)
+	}
+
+	return status, nil
+}
+
+// verify returns the status of an RRset.
+func (v *Validator) verify(set *rrset) (Status, error) {
+	if len(set.sigs) == 0 {
+		return v.unsigned(set.rrs[0].Header().Name)
+	}
+
+	status := Bogus
+	owner := dns.CanonicalName(set.rrs[0].Header().Name)
+
+	for _, sig := range set.sigs {
+		// A zone signs only the names in it.
+		if !dns.IsSubDomain(dns.CanonicalName(sig.SignerName), owner) {
+			continue
+		}
+
+		ks, err := v.keySet(sig.SignerName)
+
+		if err != nil {
+			return Indeterminate, err
+		}
+
+		switch {
+		case ks.status == Insecure:
+			status = Insecure
+		case ks.status == Secure && v.check(sig, ks.keys, set.rrs):
+			return Secure, nil
+		}
+	}
+
+	return status, nil
+}
+
+// check reports whether sig over rrs is valid and made by one of keys.
+func (v *Validator) check(
+	sig *dns.RRSIG,
+	keys []*dns.DNSKEY,
+	rrs []dns.RR,
+) bool {
+	if !sig.ValidityPeriod(v.Now()) {
+		return false
+	}
+
+	for _, k := range keys {
+		if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm {
+			continue
+		}
+
+		if sig.Verify(k, rrs) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unsigned returns the status of an unsigned RRset owned by name. It is
+// insecure in an unsigned zone and bogus in a signed one.
+func (v *Validator) unsigned(name string) (Status, error) {
+	res, err := v.Resolver.Resolve(name, dns.TypeSOA)
+
+	if err != nil {
+		return Indeterminate, err
+	}
+
+	zone := ""
+
+	for _, sec := range [][]dns.RR{res.Msg.Answer, res.Msg.Ns} {
+		for _, rr := range sec {
+			if soa, ok := rr.(*dns.SOA); ok && zone == "" {
+				zone = soa.Hdr.Name
+			}
+		}
+	}
+
+	if zone == "" {
+		return Indeterminate, nil
+	}
+
+	ks, err := v.keySet(zone)
+
+	if err != nil {
+		return Indeterminate, err
+	}
+
+	if ks.status == Secure {
+		return Bogus, nil
+	}
+
+	return ks.status, nil
+}
+
+// keySet returns the validated DNSKEY RRset of a zone. The keys are
+// authenticated by a trust anchor or by the DS RRset in the parent zone.
+func (v *Validator) keySet(zone string) (*keySet, error) {
+	zone = dns.CanonicalName(zone)
+
+	if ks, ok := v.zones[zone]; ok {
+		return ks, nil
+	}
+
+	ks, err := v.fetchKeySet(zone)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v.zones[zone] = ks
+
+	return ks, nil
+}
+
+// fetchKeySet queries the keys of a zone and authenticates them.
+func (v *Validator) fetchKeySet(zone string) (*keySet, error) {
+	anchors, trusted := v.anchors[zone]
+
+	if !trusted && zone == "." {
+		return &keySet{status: Indeterminate}, nil
+	}
+
+	if !trusted {
+		res, err := v.Resolver.Resolve(zone, dns.TypeDS)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var ds *rrset
+
+		for _, set := range group(res.Msg.Answer) {
+			if set.rrs[0].Header().Rrtype == dns.TypeDS {
+				ds = set
+			}
+		}
+
+		if ds == nil {
+			return v.noDS(zone, res.Msg)
+		}
+
+		// The DS RRset is signed by an ancestor, which also stops a loop.
+		for _, sig := range ds.sigs {
+			signer := dns.CanonicalName(sig.SignerName)
+
+			if signer == zone || !dns.IsSubDomain(signer, zone) {
+				return &keySet{status: Bogus}, nil
+			}
+		}
+
+		s, err := v.verify(ds)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if s != Secure {
+			return &keySet{status: s}, nil
+		}
+
+		anchors = ds.rrs
+	}
+
+	res, err := v.Resolver.Resolve(zone, dns.TypeDNSKEY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*dns.DNSKEY
+	var sigs []*dns.RRSIG
+
+	for _, rr := range res.Msg.Answer {
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, rr)
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+
+	var entry []*dns.DNSKEY
+
+	// Only a key authenticated by the anchors may sign the DNSKEY RRset.
+	for _, k := range keys {
+		if matches(k, anchors) {
+			entry = append(entry, k)
+		}
+	}
+
+	rrs := make([]dns.RR, len(keys))
+
+	for i, k := range keys {
+		rrs[i] = k
+	}
+
+	for _, sig := range sigs {
+		if v.check(sig, entry, rrs) {
+			return &keySet{keys: keys, status: Secure}, nil
+		}
+	}
+
+	return &keySet{status: Bogus}, nil
+}
+
+// noDS returns the status of a zone whose parent answered m without a DS
+// RRset.
+func (v *Validator) noDS(zone string, m *dns.Msg) (*keySet, error) {
+	parent := ""
+
+	for _, rr := range m.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			parent = dns.CanonicalName(soa.Hdr.Name)
+		}
+	}
+
+	// The answer comes from an ancestor, which also stops a loop.
+	if parent == "" || parent == zone || !dns.IsSubDomain(parent, zone) {
+		return &keySet{status: Bogus}, nil
+	}
+
+	ks, err := v.keySet(parent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ks.status != Secure {
+		return &keySet{status: ks.status}, nil
+	}
+
+	var proof []dns.RR
+
+	for _, set := range group(m.Ns) {
+		switch set.rrs[0].Header().Rrtype {
+		case dns.TypeNSEC, dns.TypeNSEC3:
+		default:
+			continue
+		}
+
+		for _, sig := range set.sigs {
+			if dns.CanonicalName(sig.SignerName) == parent &&
+				v.check(sig, ks.keys, set.rrs) {
+				proof = append(proof, set.rrs...)
+
+				break
+			}
+		}
+	}
+
+	if deniesDS(zone, proof) {
+		return &keySet{status: Insecure}, nil
+	}
+
+	return &keySet{status: Bogus}, nil
+}
+
+// deniesDS reports whether the NSEC or NSEC3 records prove that zone is a
+// delegation without a DS RRset, see RFC 4035 section 5.2 and RFC 5155
+// section 8.6.
+func deniesDS(zone string, rrs []dns.RR) bool {
+	var nsec3s []*dns.NSEC3
+
+	for _, rr := range rrs {
+		switch rr := rr.(type) {
+		case *dns.NSEC:
+			if dns.CanonicalName(rr.Hdr.Name) == zone {
+				return delegation(rr.TypeBitMap)
+			}
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, rr)
+		}
+	}
+
+	for _, rr := range nsec3s {
+		if rr.Match(zone) {
+			return delegation(rr.TypeBitMap)
+		}
+	}
+
+	// Without a match, the next closer name of the closest encloser is
+	// covered by an opt-out NSEC3.
+	labels := dns.Split(zone)
+
+	for i := 1; i <= len(labels); i++ {
+		ce, next := ".", zone[labels[i-1]:]
+
+		if i < len(labels) {
+			ce = zone[labels[i]:]
+		}
+
+		for _, rr := range nsec3s {
+			if !rr.Match(ce) {
+				continue
+			}
+
+			for _, rr := range nsec3s {
+				if rr.Flags&1 == 1 && rr.Cover(next) {
+					return true
+				}
+			}
+
+			return false
+		}
+	}
+
+	return false
+}
+
+// delegation reports whether the types of an NSEC or NSEC3 record are those
+// of a delegation without a DS RRset.
+func delegation(types []uint16) bool {
+	ns := false
+
+	for _, t := range types {
+		switch t {
+		case dns.TypeNS:
+			ns = true
+		case dns.TypeDS, dns.TypeSOA:
+			return false
+		}
+	}
+
+	return ns
+}
+
+// matches reports whether k is authenticated by one of the DS or DNSKEY
+// records.
+func matches(k *dns.DNSKEY, anchors []dns.RR) bool {
+	for _, rr := range anchors {
+		switch a := rr.(type) {
+		case *dns.DS:
+			if a.KeyTag != k.KeyTag() || a.Algorithm != k.Algorithm {
+				continue
+			}
+
+			ds := k.ToDS(a.DigestType)
+
+			if ds != nil && strings.EqualFold(ds.Digest, a.Digest) {
+				return true
+			}
+		case *dns.DNSKEY:
+			if a.Flags == k.Flags &&
+				a.Algorithm == k.Algorithm &&
+				a.PublicKey == k.PublicKey {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,386 @@
+package dnssec_test
+
+import (
+	"crypto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/dnssec"
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// zone is a signed zone of the test hierarchy.
+type zone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newZone(t *testing.T, name string) *zone {
+	t.Helper()
+
+	z := &zone{name: name}
+
+	z.key = &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+
+	priv, err := z.key.Generate(256)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	z.priv = priv.(crypto.Signer)
+
+	return z
+}
+
+// sign returns the signature of rrs by the zone.
+func (z *zone) sign(t *testing.T, rrs ...dns.RR) dns.RR {
+	t.Helper()
+
+	now := time.Now().Unix()
+
+	sig := &dns.RRSIG{
+		Hdr: dns.RR_Header{
+			Name:   rrs[0].Header().Name,
+			Rrtype: dns.TypeRRSIG,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(now - 3600),
+		Expiration: uint32(now + 3600),
+	}
+
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	return sig
+}
+
+func rr(s string) dns.RR {
+	r, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
+
+// stub is a Resolver answering from a fixed set of records, or from a fixed
+// authority section. Other names get the SOA of their zone in the authority
+// section.
+type stub struct {
+	answers map[string][]dns.RR
+	ns      map[string][]dns.RR
+	soas    []dns.RR
+}
+
+func (s *stub) Resolve(name string, qtype uint16) (*resolver.Result, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.Response = true
+
+	key := dns.CanonicalName(name) + "/" + dns.TypeToString[qtype]
+
+	if ans, ok := s.answers[key]; ok {
+		m.Answer = ans
+	} else if ns, ok := s.ns[key]; ok {
+		m.Ns = ns
+	} else {
+		var best dns.RR
+
+		for _, soa := range s.soas {
+			zone := soa.Header().Name
+
+			if dns.IsSubDomain(zone, m.Question[0].Name) &&
+				(best == nil || len(zone) > len(best.Header().Name)) {
+				best = soa
+			}
+		}
+
+		if best != nil {
+			m.Ns = []dns.RR{best}
+		}
+	}
+
+	return &resolver.Result{Msg: m}, nil
+}
+
+// hierarchy builds a signed root with the signed zones test. and st., the
+// unsigned zones unsigned. and optout.test. whose DS records are denied, and the
+// unsigned zone forged. whose denial has no proof, and returns a Resolver for
+// it with the root anchor.
+func hierarchy(t *testing.T) (*stub, []dns.RR) {
+	t.Helper()
+
+	root := newZone(t, ".")
+	signed := newZone(t, "test.")
+	suffix := newZone(t, "st.")
+
+	s := &stub{
+		answers: make(map[string][]dns.RR),
+		ns:      make(map[string][]dns.RR),
+	}
+
+	add := func(z *zone, rrs ...dns.RR) {
+		hdr := rrs[0].Header()
+		key := dns.CanonicalName(hdr.Name) + "/" + dns.TypeToString[hdr.Rrtype]
+
+		if z != nil {
+			rrs = append(rrs, z.sign(t, rrs...))
+		}
+
+		s.answers[key] = rrs
+	}
+
+	add(root, root.key)
+
+	add(root, signed.key.ToDS(dns.SHA256))
+	add(signed, signed.key)
+
+	soa := rr("test. 3600 IN SOA ns.test. admin.test. 1 3600 600 86400 300")
+	add(signed, soa)
+	s.soas = append(s.soas, soa)
+
+	add(signed, rr("a.test. 60 IN A 192.0.2.1"))
+
+	bad := rr("bad.test. 60 IN A 192.0.2.1")
+	sig := signed.sign(t, bad)
+	s.answers["bad.test./A"] = []dns.RR{
+		rr("bad.test. 60 IN A 192.0.2.2"),
+		sig,
+	}
+
+	add(nil, rr("nosig.test. 60 IN A 192.0.2.1"))
+
+	usoa := rr("unsigned. 3600 IN SOA ns.unsigned. admin.unsigned. 1 3600 600 86400 300")
+	add(nil, usoa)
+	s.soas = append(s.soas, usoa)
+
+	add(nil, rr("a.unsigned. 60 IN A 192.0.2.1"))
+
+	// st. is a suffix of test. but not its parent.
+	add(root, suffix.key.ToDS(dns.SHA256))
+	add(suffix, suffix.key)
+
+	spoof := rr("spoof.test. 60 IN A 192.0.2.1")
+	s.answers["spoof.test./A"] = []dns.RR{spoof, suffix.sign(t, spoof)}
+
+	rsoa := rr(". 3600 IN SOA ns.root. admin.root. 1 3600 600 86400 300")
+	denial := func(z *zone, soa dns.RR, rrs ...dns.RR) []dns.RR {
+		out := []dns.RR{soa, z.sign(t, soa)}
+
+		for _, r := range rrs {
+			out = append(out, r, z.sign(t, r))
+		}
+
+		return out
+	}
+
+	s.ns["unsigned./DS"] = denial(
+		root,
+		rsoa,
+		rr("unsigned. 3600 IN NSEC zz. NS RRSIG NSEC"),
+	)
+
+	hash := func(name string) string {
+		return dns.HashName(name, dns.SHA1, 0, "")
+	}
+
+	nsec3 := func(owner string, flags uint8, next string, types ...uint16) dns.RR {
+		return &dns.NSEC3{
+			Hdr: dns.RR_Header{
+				Name:   hash(owner) + ".test.",
+				Rrtype: dns.TypeNSEC3,
+				Class:  dns.ClassINET,
+				Ttl:    3600,
+			},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			HashLength: 20,
+			NextDomain: hash(next),
+			TypeBitMap: types,
+		}
+	}
+
+	// test. matches and an opt-out NSEC3 covers optout.test. in an empty
+	// interval.
+	s.ns["optout.test./DS"] = denial(
+		signed,
+		soa,
+		nsec3("test.", 0, "test.", dns.TypeNS, dns.TypeSOA),
+		nsec3("x.test.", 1, "x.test."),
+	)
+
+	osoa := rr("optout.test. 3600 IN SOA ns.test. admin.test. 1 3600 600 86400 300")
+	add(nil, osoa)
+	s.soas = append(s.soas, osoa)
+
+	add(nil, rr("a.optout.test. 60 IN A 192.0.2.1"))
+
+	s.ns["forged./DS"] = denial(root, rsoa)
+
+	fsoa := rr("forged. 3600 IN SOA ns.forged. admin.forged. 1 3600 600 86400 300")
+	add(nil, fsoa)
+	s.soas = append(s.soas, fsoa)
+
+	add(nil, rr("a.forged. 60 IN A 192.0.2.1"))
+
+	return s, []dns.RR{root.key.ToDS(dns.SHA256)}
+}
+
+func TestFromAD(t *testing.T) {
+	m := new(dns.Msg)
+	assert.Equal(t, dnssec.Insecure, dnssec.FromAD(m))
+
+	m.AuthenticatedData = true
+	assert.Equal(t, dnssec.Secure, dnssec.FromAD(m))
+}
+
+func TestLoadAnchors(t *testing.T) {
+	dir := t.TempDir()
+
+	good := filepath.Join(dir, "root.key")
+	os.WriteFile(good, []byte(
+		"; root anchor\n"+
+			". 172800 IN DS 20326 8 2 "+
+			"E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D\n",
+	), 0o644)
+
+	anchors, err := dnssec.LoadAnchors(good)
+
+	if assert.NoError(t, err) && assert.Len(t, anchors, 1) {
+		assert.Equal(t, uint16(20326), anchors[0].(*dns.DS).KeyTag)
+	}
+
+	bad := filepath.Join(dir, "bad.key")
+	os.WriteFile(bad, []byte(". 3600 IN A 192.0.2.1\n"), 0o644)
+
+	_, err = dnssec.LoadAnchors(bad)
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.key")
+	os.WriteFile(empty, []byte("; nothing\n"), 0o644)
+
+	_, err = dnssec.LoadAnchors(empty)
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	s, anchors := hierarchy(t)
+
+	tests := []struct {
+		name  string
+		qname string
+		want  dnssec.Status
+	}{
+		{
+			name:  "secure",
+			qname: "a.test.",
+			want:  dnssec.Secure,
+		},
+		{
+			name:  "tampered",
+			qname: "bad.test.",
+			want:  dnssec.Bogus,
+		},
+		{
+			name:  "strippedSignature",
+			qname: "nosig.test.",
+			want:  dnssec.Bogus,
+		},
+		{
+			name:  "unsignedZone",
+			qname: "a.unsigned.",
+			want:  dnssec.Insecure,
+		},
+		{
+			name:  "optOut",
+			qname: "a.optout.test.",
+			want:  dnssec.Insecure,
+		},
+		{
+			name:  "strippedDS",
+			qname: "a.forged.",
+			want:  dnssec.Bogus,
+		},
+		{
+			name:  "suffixSigner",
+			qname: "spoof.test.",
+			want:  dnssec.Bogus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := dnssec.NewValidator(s, anchors)
+
+			res, _ := s.Resolve(tt.qname, dns.TypeA)
+			got, err := v.Validate(res.Msg)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestValidateWrongAnchor(t *testing.T) {
+	s, _ := hierarchy(t)
+	other := newZone(t, ".")
+
+	v := dnssec.NewValidator(s, []dns.RR{other.key})
+
+	res, _ := s.Resolve("a.test.", dns.TypeA)
+	got, err := v.Validate(res.Msg)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dnssec.Bogus, got)
+	}
+}
+
+func TestValidateExpired(t *testing.T) {
+	s, anchors := hierarchy(t)
+
+	v := dnssec.NewValidator(s, anchors)
+	v.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	res, _ := s.Resolve("a.test.", dns.TypeA)
+	got, err := v.Validate(res.Msg)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dnssec.Bogus, got)
+	}
+}
+
+func TestValidateServFail(t *testing.T) {
+	s, anchors := hierarchy(t)
+	v := dnssec.NewValidator(s, anchors)
+
+	m := new(dns.Msg)
+	m.SetQuestion("a.test.", dns.TypeA)
+	m.Rcode = dns.RcodeServerFailure
+
+	got, err := v.Validate(m)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dnssec.Indeterminate, got)
+	}
+}
@@ -0,0 +1,351 @@
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ErrFormat is returned for a line not in the format of a block list.
+var ErrFormat = errors.New("line not in the format")
+
+// Line is a line of a block list: names blocked with an address, a comment,
+// or both. A line without either is blank.
+type Line struct {
+	// Addr is the address the names resolve to, empty if they do not exist.
+	Addr    string
+	Names   []string
+	Comment string
+}
+
+// Format reads and writes the lines of a block list.
+type Format interface {
+	// Parse returns the line in the format, nil for a line without names or
+	// comment to convert such as a header, or ErrFormat.
+	Parse(line string) (*Line, error)
+	// Format returns l in the format, with addr for names without one.
+	Format(l *Line, addr string) []string
+}
+
+// Formats are the formats of block lists by name.
+var Formats = map[string]Format{
+	"hosts":          hostsFormat{},
+	"domains":        domainsFormat{},
+	"dnsmasq":        dnsmasqFormat{},
+	"dnsmasq-server": dnsmasqFormat{server: true},
+	"unbound":        unboundFormat{},
+	"adblock":        adblockFormat{},
+}
+
+// comment returns the comment of a line starting with one of the markers.
+func comment(line string, markers string) (string, bool) {
+	if line != "" && strings.ContainsRune(markers, rune(line[0])) {
+		return line[1:], true
+	}
+
+	return "", false
+}
+
+// commented returns the names of l formatted by name, with the comment of l
+// on a line of its own before them for formats without trailing comments.
+func commented(l *Line, marker string, name func(string) []string) []string {
+	if len(l.Names) == 0 && l.Comment == "" {
+		return []string{""}
+	}
+
+	var out []string
+
+	if l.Comment != "" {
+		out = append(out, marker+l.Comment)
+	}
+
+	for _, n := range l.Names {
+		out = append(out, name(n)...)
+	}
+
+	return out
+}
+
+// hostsFormat is a hosts file.
+type hostsFormat struct{}
+
+func (hostsFormat) Parse(line string) (*Line, error) {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return &Line{}, nil
+	}
+
+	if c, ok := comment(line, "#;"); ok {
+		return &Line{Comment: c}, nil
+	}
+
+	ip, hns, cmt := ParseLine(line)
+
+	if _, err := netip.ParseAddr(ip); err != nil || len(hns) == 0 {
+		return nil, ErrFormat
+	}
+
+	return &Line{Addr: ip, Names: hns, Comment: cmt}, nil
+}
+
+func (hostsFormat) Format(l *Line, addr string) []string {
+	if len(l.Names) == 0 {
+		if l.Comment == "" {
+			return []string{""}
+		}
+
+		return []string{"#" + l.Comment}
+	}
+
+	if l.Addr != "" {
+		addr = l.Addr
+	}
+
+	var b strings.Builder
+
+	b.WriteString(addr)
+
+	for _, n := range l.Names {
+		b.WriteString(" " + n)
+	}
+
+	if l.Comment != "" {
+		b.WriteString(" #" + l.Comment)
+	}
+
+	return []string{b.String()}
+}
+
+// domainsFormat is a list of domains, one on each line.
+type domainsFormat struct{}
+
+func (domainsFormat) Parse(line string) (*Line, error) {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return &Line{}, nil
+	}
+
+	if c, ok := comment(line, "#"); ok {
+		return &Line{Comment: c}, nil
+	}
+
+	name, cmt, _ := strings.Cut(line, "#")
+	flds := strings.Fields(name)
+
+	if len(flds) != 1 {
+		return nil, ErrFormat
+	}
+
+	return &Line{Names: flds, Comment: cmt}, nil
+}
+
+func (domainsFormat) Format(l *Line, _ string) []string {
+	if len(l.Names) == 0 {
+		return hostsFormat{}.Format(l, "")
+	}
+
+	out := make([]string, 0, len(l.Names))
+
+	for i, n := range l.Names {
+		if i == 0 && l.Comment != "" {
+			n += " #" + l.Comment
+		}
+
+		out = append(out, n)
+	}
+
+	return out
+}
+
+// dnsmasqFormat is a dnsmasq configuration of address lines, or server lines
+// without an upstream if server is set.
+type dnsmasqFormat struct {
+	server bool
+}
+
+func (dnsmasqFormat) Parse(line string) (*Line, error) {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return &Line{}, nil
+	}
+
+	if c, ok := comment(line, "#"); ok {
+		return &Line{Comment: c}, nil
+	}
+
+	key, val, ok := strings.Cut(line, "=")
+
+	if !ok || !strings.HasPrefix(val, "/") {
+		return nil, ErrFormat
+	}
+
+	flds := strings.Split(val[1:], "/")
+	names, addr := flds[:len(flds)-1], flds[len(flds)-1]
+
+	if len(names) == 0 {
+		return nil, ErrFormat
+	}
+
+	switch key {
+	case "address":
+		if addr == "#" {
+			addr = ""
+		}
+
+		if _, err := netip.ParseAddr(addr); addr != "" && err != nil {
+			return nil, ErrFormat
+		}
+	case "server", "local":
+		// A server line with an upstream forwards the names.
+		if addr != "" {
+			return nil, ErrFormat
+		}
+	default:
+		return nil, ErrFormat
+	}
+
+	return &Line{Addr: addr, Names: names}, nil
+}
+
+func (f dnsmasqFormat) Format(l *Line, addr string) []string {
+	if l.Addr != "" {
+		addr = l.Addr
+	}
+
+	return commented(l, "#", func(n string) []string {
+		if f.server {
+			return []string{"server=/" + n + "/"}
+		}
+
+		return []string{"address=/" + n + "/" + addr}
+	})
+}
+
+// unboundFormat is an Unbound configuration of local zones.
+type unboundFormat struct{}
+
+func (unboundFormat) Parse(line string) (*Line, error) {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return &Line{}, nil
+	}
+
+	if c, ok := comment(line, "#"); ok {
+		return &Line{Comment: c}, nil
+	}
+
+	line, cmt, _ := strings.Cut(line, "#")
+	key, val, _ := strings.Cut(line, ":")
+	val = strings.TrimSpace(val)
+
+	switch strings.TrimSpace(key) {
+	case "server":
+		return nil, nil
+	case "local-zone":
+		flds := strings.Fields(val)
+
+		if len(flds) != 2 {
+			return nil, ErrFormat
+		}
+
+		switch flds[1] {
+		case "redirect", "inform_redirect":
+			// The address is given by the local-data line of the zone.
+			return nil, nil
+		case "always_nxdomain", "always_refuse", "static", "refuse",
+			"deny", "inform_deny", "always_null":
+		default:
+			return nil, ErrFormat
+		}
+
+		name := strings.TrimSuffix(strings.Trim(flds[0], `"`), ".")
+
+		return &Line{Names: []string{name}, Comment: cmt}, nil
+	case "local-data":
+		rr, err := dns.NewRR(strings.Trim(val, `"`))
+
+		if err != nil || rr == nil {
+			return nil, ErrFormat
+		}
+
+		var addr string
+
+		switch rr := rr.(type) {
+		case *dns.A:
+			addr = rr.A.String()
+		case *dns.AAAA:
+			addr = rr.AAAA.String()
+		default:
+			return nil, ErrFormat
+		}
+
+		name := strings.TrimSuffix(rr.Header().Name, ".")
+
+		return &Line{Addr: addr, Names: []string{name}, Comment: cmt}, nil
+	}
+
+	return nil, ErrFormat
+}
+
+func (unboundFormat) Format(l *Line, addr string) []string {
+	if l.Addr != "" {
+		addr = l.Addr
+	}
+
+	qtype := "A"
+
+	if a, err := netip.ParseAddr(addr); err == nil && a.Is6() {
+		qtype = "AAAA"
+	}
+
+	// Local data alone answers only the name, as a hosts file does.
+	return commented(l, "#", func(n string) []string {
+		return []string{fmt.Sprintf(`local-data: "%s %s %s"`, n, qtype, addr)}
+	})
+}
+
+// adblockFormat is an AdBlock filter list of domain rules.
+type adblockFormat struct{}
+
+func (adblockFormat) Parse(line string) (*Line, error) {
+	line = strings.TrimSpace(line)
+
+	switch {
+	case line == "":
+		return &Line{}, nil
+	case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+		// A header such as [Adblock Plus 2.0].
+		return nil, nil
+	}
+
+	if c, ok := comment(line, "!"); ok {
+		return &Line{Comment: c}, nil
+	}
+
+	rule := strings.TrimSuffix(line, "$important")
+
+	if !strings.HasPrefix(rule, "||") || !strings.HasSuffix(rule, "^") {
+		return nil, ErrFormat
+	}
+
+	name := rule[2 : len(rule)-1]
+
+	if name == "" || strings.ContainsAny(name, "*/|^$") {
+		return nil, ErrFormat
+	}
+
+	return &Line{Names: []string{name}}, nil
+}
+
+func (adblockFormat) Format(l *Line, _ string) []string {
+	return commented(l, "!", func(n string) []string {
+		return []string{"||" + n + "^"}
+	})
+}
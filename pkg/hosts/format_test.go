@@ -0,0 +1,267 @@
+package hosts_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+func TestFormatParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		line   string
+		want   *hosts.Line
+		err    error
+	}{
+		{
+			name:   "hosts",
+			format: "hosts",
+			line:   "0.0.0.0 a.com b.com # ads",
+			want: &hosts.Line{
+				Addr:    "0.0.0.0",
+				Names:   []string{"a.com", "b.com"},
+				Comment: " ads",
+			},
+		},
+		{
+			name:   "hostsComment",
+			format: "hosts",
+			line:   "# ads",
+			want:   &hosts.Line{Comment: " ads"},
+		},
+		{
+			name:   "hostsBlank",
+			format: "hosts",
+			line:   "  ",
+			want:   &hosts.Line{},
+		},
+		{
+			name:   "hostsDomain",
+			format: "hosts",
+			line:   "a.com",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "hostsNotAddress",
+			format: "hosts",
+			line:   "a.com b.com",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "domains",
+			format: "domains",
+			line:   "a.com #ads",
+			want:   &hosts.Line{Names: []string{"a.com"}, Comment: "ads"},
+		},
+		{
+			name:   "domainsHosts",
+			format: "domains",
+			line:   "0.0.0.0 a.com",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "dnsmasqAddress",
+			format: "dnsmasq",
+			line:   "address=/a.com/b.com/0.0.0.0",
+			want: &hosts.Line{
+				Addr:  "0.0.0.0",
+				Names: []string{"a.com", "b.com"},
+			},
+		},
+		{
+			name:   "dnsmasqNXDomain",
+			format: "dnsmasq",
+			line:   "address=/a.com/",
+			want:   &hosts.Line{Names: []string{"a.com"}},
+		},
+		{
+			name:   "dnsmasqServer",
+			format: "dnsmasq",
+			line:   "server=/a.com/",
+			want:   &hosts.Line{Names: []string{"a.com"}},
+		},
+		{
+			name:   "dnsmasqForward",
+			format: "dnsmasq",
+			line:   "server=/corp.example/10.0.0.1",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "dnsmasqOption",
+			format: "dnsmasq",
+			line:   "cache-size=1000",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "unboundServer",
+			format: "unbound",
+			line:   "server:",
+		},
+		{
+			name:   "unboundRedirect",
+			format: "unbound",
+			line:   `local-zone: "a.com" redirect`,
+		},
+		{
+			name:   "unboundData",
+			format: "unbound",
+			line:   `  local-data: "a.com. 3600 IN AAAA ::" # ads`,
+			want: &hosts.Line{
+				Addr:    "::",
+				Names:   []string{"a.com"},
+				Comment: " ads",
+			},
+		},
+		{
+			name:   "unboundNXDomain",
+			format: "unbound",
+			line:   `local-zone: "a.com." always_nxdomain`,
+			want:   &hosts.Line{Names: []string{"a.com"}},
+		},
+		{
+			name:   "unboundTransparent",
+			format: "unbound",
+			line:   `local-zone: "a.com." transparent`,
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "adblock",
+			format: "adblock",
+			line:   "||a.com^",
+			want:   &hosts.Line{Names: []string{"a.com"}},
+		},
+		{
+			name:   "adblockImportant",
+			format: "adblock",
+			line:   "||a.com^$important",
+			want:   &hosts.Line{Names: []string{"a.com"}},
+		},
+		{
+			name:   "adblockComment",
+			format: "adblock",
+			line:   "! Title: ads",
+			want:   &hosts.Line{Comment: " Title: ads"},
+		},
+		{
+			name:   "adblockHeader",
+			format: "adblock",
+			line:   "[Adblock Plus 2.0]",
+		},
+		{
+			name:   "adblockThirdParty",
+			format: "adblock",
+			line:   "||a.com^$third-party",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "adblockException",
+			format: "adblock",
+			line:   "@@||a.com^",
+			err:    hosts.ErrFormat,
+		},
+		{
+			name:   "adblockPath",
+			format: "adblock",
+			line:   "||a.com/ads^",
+			err:    hosts.ErrFormat,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hosts.Formats[tt.format].Parse(tt.line)
+
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFormatFormat(t *testing.T) {
+	entry := &hosts.Line{
+		Names:   []string{"a.com", "b.com"},
+		Comment: " ads",
+	}
+
+	tests := []struct {
+		format string
+		line   *hosts.Line
+		want   []string
+	}{
+		{
+			format: "hosts",
+			line:   entry,
+			want:   []string{"0.0.0.0 a.com b.com # ads"},
+		},
+		{
+			format: "domains",
+			line:   entry,
+			want:   []string{"a.com # ads", "b.com"},
+		},
+		{
+			format: "dnsmasq",
+			line:   entry,
+			want: []string{
+				"# ads",
+				"address=/a.com/0.0.0.0",
+				"address=/b.com/0.0.0.0",
+			},
+		},
+		{
+			format: "dnsmasq-server",
+			line:   &hosts.Line{Names: []string{"a.com"}},
+			want:   []string{"server=/a.com/"},
+		},
+		{
+			format: "unbound",
+			line:   &hosts.Line{Addr: "::", Names: []string{"a.com"}},
+			want:   []string{`local-data: "a.com AAAA ::"`},
+		},
+		{
+			format: "adblock",
+			line:   entry,
+			want:   []string{"! ads", "||a.com^", "||b.com^"},
+		},
+		{
+			format: "adblock",
+			line:   &hosts.Line{},
+			want:   []string{""},
+		},
+		{
+			format: "unbound",
+			line:   &hosts.Line{Comment: " ads"},
+			want:   []string{"# ads"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			assert.Equal(
+				t,
+				tt.want,
+				hosts.Formats[tt.format].Format(tt.line, "0.0.0.0"),
+			)
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	line := &hosts.Line{Addr: "0.0.0.0", Names: []string{"a.com"}}
+
+	for name, f := range hosts.Formats {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+
+			for _, s := range f.Format(line, "0.0.0.0") {
+				l, err := f.Parse(s)
+
+				if assert.NoError(t, err) && l != nil {
+					got = append(got, l.Names...)
+				}
+			}
+
+			assert.Equal(t, line.Names, got)
+		})
+	}
+}
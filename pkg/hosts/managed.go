@@ -0,0 +1,36 @@
+package hosts
+
+import "strings"
+
+// Markers of the section of a hosts file managed by lpc.
+const (
+	BeginManaged = "# BEGIN lpc"
+	EndManaged   = "# END lpc"
+)
+
+// Section tracks the section managed by lpc over the lines of a hosts file.
+type Section struct {
+	in bool
+}
+
+// Managed reports whether line is a marker or inside the managed section.
+func (s *Section) Managed(line string) bool {
+	switch strings.TrimSpace(line) {
+	case BeginManaged:
+		s.in = true
+
+		return true
+	case EndManaged:
+		in := s.in
+		s.in = false
+
+		return in
+	}
+
+	return s.in
+}
+
+// Open reports whether the managed section is not ended.
+func (s *Section) Open() bool {
+	return s.in
+}
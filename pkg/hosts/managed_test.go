@@ -0,0 +1,38 @@
+package hosts_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+func TestSection(t *testing.T) {
+	lines := strings.Split(strings.Join([]string{
+		"0.0.0.0 a.com",
+		"# END lpc",
+		"# BEGIN lpc",
+		"0.0.0.0 www.a.com",
+		"  # END lpc  ",
+		"0.0.0.0 b.com",
+		"# BEGIN lpc",
+		"0.0.0.0 www.b.com",
+	}, "\n"), "\n")
+
+	var s hosts.Section
+
+	got := make([]bool, 0, len(lines))
+
+	for _, l := range lines {
+		got = append(got, s.Managed(l))
+	}
+
+	assert.Equal(
+		t,
+		[]bool{false, false, true, true, true, false, true, true},
+		got,
+	)
+	assert.True(t, s.Open())
+}
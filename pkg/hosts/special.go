@@ -0,0 +1,41 @@
+package hosts
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// specialDomains are the special-use domains not resolved on the public DNS,
+// see RFC 6761, RFC 6762, RFC 7686, RFC 8375 and RFC 9476.
+var specialDomains = []string{
+	"localhost",
+	"local",
+	"invalid",
+	"test",
+	"onion",
+	"alt",
+	"home.arpa",
+}
+
+// IsSpecial reports whether the hostname is never queried: an address, a
+// single label such as localhost or broadcasthost, or a name in a special-use
+// domain.
+func IsSpecial(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if _, err := netip.ParseAddr(name); err == nil {
+		return true
+	}
+
+	if !strings.Contains(name, ".") {
+		return true
+	}
+
+	for _, d := range specialDomains {
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package hosts_test
+
+import (
+	"testing"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSpecial(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{name: "public", host: "ads.example.com", want: false},
+		{name: "fqdn", host: "ads.example.com.", want: false},
+		{name: "localhost", host: "localhost", want: true},
+		{name: "subdomainOfLocalhost", host: "foo.localhost", want: true},
+		{name: "singleLabel", host: "broadcasthost", want: true},
+		{name: "mDNS", host: "printer.local", want: true},
+		{name: "upperCase", host: "Printer.LOCAL", want: true},
+		{name: "onion", host: "abc.onion", want: true},
+		{name: "homeArpa", host: "router.home.arpa", want: true},
+		{name: "arpa", host: "1.0.0.127.in-addr.arpa", want: false},
+		{name: "singleLabelSuffix", host: "mylocal", want: true},
+		{name: "notSuffix", host: "local.example.com", want: false},
+		{name: "IPv4", host: "0.0.0.0", want: true},
+		{name: "IPv6", host: "::1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hosts.IsSpecial(tt.host))
+		})
+	}
+}
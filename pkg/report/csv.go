@@ -0,0 +1,86 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// header is the first row of a CSV report.
+var header = []string{
+	"name",
+	"line",
+	"source",
+	"entry",
+	"prefix",
+	"qtypes",
+	"rcode",
+	"answers",
+	"cnames",
+	"class",
+	"upstream",
+	"transport",
+	"rtt_ms",
+	"elapsed_ms",
+	"dnssec",
+	"scope",
+	"added",
+	"wildcard",
+	"error",
+}
+
+// csvWriter writes a row of each record after the header, with the lists
+// separated by spaces.
+type csvWriter struct {
+	w *csv.Writer
+	n int
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) Write(rec *Record) error {
+	if cw.n == 0 {
+		if err := cw.w.Write(header); err != nil {
+			return err
+		}
+	}
+
+	cw.n++
+
+	return cw.w.Write([]string{
+		rec.Name,
+		strconv.Itoa(rec.Line),
+		rec.Source,
+		rec.Entry,
+		rec.Prefix,
+		strings.Join(rec.Qtypes, " "),
+		rec.Rcode,
+		strings.Join(rec.Answers, " "),
+		strings.Join(rec.CNAMEs, " "),
+		string(rec.Class),
+		rec.Upstream,
+		rec.Transport,
+		strconv.FormatFloat(rec.RTT, 'f', -1, 64),
+		strconv.FormatFloat(rec.Elapsed, 'f', -1, 64),
+		rec.DNSSEC,
+		rec.Scope,
+		strconv.FormatBool(rec.Added),
+		strconv.FormatBool(rec.Wildcard),
+		rec.Error,
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	if cw.n == 0 {
+		if err := cw.w.Write(header); err != nil {
+			return err
+		}
+	}
+
+	cw.w.Flush()
+
+	return cw.w.Error()
+}
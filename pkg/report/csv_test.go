@@ -0,0 +1,57 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/report"
+)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, _ := report.NewWriter(&buf, report.FormatCSV)
+
+	assert.NoError(t, w.Write(&report.Record{
+		Name:    "www.a.com",
+		Line:    2,
+		Source:  "0.0.0.0 a.com # ads",
+		Entry:   "a.com",
+		Prefix:  "www.",
+		Qtypes:  []string{"A"},
+		Rcode:   "NOERROR",
+		Answers: []string{"192.0.2.1", "192.0.2.2"},
+		Class:   check.Resolves,
+		RTT:     1.5,
+		Added:   true,
+	}))
+	assert.NoError(t, w.Write(&report.Record{
+		Name:  "b.com",
+		Line:  3,
+		Entry: "b.com",
+		Class: check.Error,
+		Error: "read udp: i/o timeout, \"retried\"",
+	}))
+	assert.NoError(t, w.Close())
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+
+	if assert.NoError(t, err) && assert.Len(t, rows, 3) {
+		assert.Equal(t, "name", rows[0][0])
+		assert.Equal(t, []string{
+			"www.a.com", "2", "0.0.0.0 a.com # ads", "a.com", "www.", "A",
+			"NOERROR", "192.0.2.1 192.0.2.2", "", "resolves", "", "", "1.5",
+			"0", "", "", "true", "false", "",
+		}, rows[1])
+		assert.Equal(t, "read udp: i/o timeout, \"retried\"", rows[2][18])
+	}
+
+	buf.Reset()
+	w, _ = report.NewWriter(&buf, report.FormatCSV)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")))
+}
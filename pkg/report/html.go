@@ -0,0 +1,195 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+// page is the template of an HTML report, with its styles and scripts
+// inline so that the file is self-contained.
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"domain": Registrable,
+	"join":   strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>lpc report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+th { background: #eee; cursor: pointer; }
+td.num { text-align: right; }
+tr:target { background: #ffc; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<h1>lpc report</h1>
+<table>
+<tr><th>Classification</th><th>Names</th></tr>
+{{- range .Counts}}
+<tr><td>{{.Class}}</td><td class="num">{{.Names}}</td></tr>
+{{- end}}
+<tr><td><b>total</b></td><td class="num"><b>{{.Total}}</b></td></tr>
+</table>
+<p>
+<label>Classification
+<select id="class">
+<option value="">all</option>
+{{- range .Counts}}
+<option>{{.Class}}</option>
+{{- end}}
+</select></label>
+<label>Registrable domain <input id="domain" type="search"></label>
+</p>
+<h2>New leaks ({{len .Leaks}})</h2>
+<table class="sortable">
+<thead><tr><th>Name</th><th>Entry</th><th>Domain</th><th>Line</th><th>Answers</th><th>CNAMEs</th><th>Wildcard</th></tr></thead>
+<tbody>
+{{- range .Leaks}}
+<tr data-class="{{.Class}}" data-domain="{{domain .Entry}}"><td>{{.Name}}</td><td>{{.Entry}}</td><td>{{domain .Entry}}</td><td class="num"><a href="#L{{.Line}}">{{.Line}}</a></td><td>{{join .Answers " "}}</td><td>{{join .CNAMEs " "}}</td><td>{{if .Wildcard}}yes{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Dead entries ({{len .Dead}})</h2>
+<table class="sortable">
+<thead><tr><th>Entry</th><th>Domain</th><th>Line</th></tr></thead>
+<tbody>
+{{- range .Dead}}
+<tr data-class="{{.Class}}" data-domain="{{domain .Entry}}"><td>{{.Name}}</td><td>{{domain .Entry}}</td><td class="num"><a href="#L{{.Line}}">{{.Line}}</a></td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Wildcard zones ({{len .Wildcards}})</h2>
+<table class="sortable">
+<thead><tr><th>Zone</th><th>Domain</th><th>Line</th><th>Answers</th></tr></thead>
+<tbody>
+{{- range .Wildcards}}
+<tr data-class="{{.Class}}" data-domain="{{domain .Entry}}"><td>{{.Entry}}</td><td>{{domain .Entry}}</td><td class="num"><a href="#L{{.Line}}">{{.Line}}</a></td><td>{{join .Answers " "}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Errors ({{len .Errors}})</h2>
+<table class="sortable">
+<thead><tr><th>Name</th><th>Domain</th><th>Line</th><th>Classification</th><th>Error</th></tr></thead>
+<tbody>
+{{- range .Errors}}
+<tr data-class="{{.Class}}" data-domain="{{domain .Entry}}"><td>{{.Name}}</td><td>{{domain .Entry}}</td><td class="num"><a href="#L{{.Line}}">{{.Line}}</a></td><td>{{.Class}}</td><td>{{if .Error}}{{.Error}}{{else}}{{.Rcode}}{{end}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>All names ({{.Total}})</h2>
+<table class="sortable">
+<thead><tr><th>Name</th><th>Entry</th><th>Domain</th><th>Line</th><th>Classification</th><th>Rcode</th><th>Answers</th><th>RTT (ms)</th></tr></thead>
+<tbody>
+{{- range .Records}}
+<tr data-class="{{.Class}}" data-domain="{{domain .Entry}}"><td>{{.Name}}</td><td>{{.Entry}}</td><td>{{domain .Entry}}</td><td class="num"><a href="#L{{.Line}}">{{.Line}}</a></td><td>{{.Class}}</td><td>{{.Rcode}}</td><td>{{join .Answers " "}}</td><td class="num">{{.RTT}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>Source lines</h2>
+<table>
+<thead><tr><th>Line</th><th>Text</th></tr></thead>
+<tbody>
+{{- range .Sources}}
+<tr id="L{{.Line}}"><td class="num">{{.Line}}</td><td><code>{{.Text}}</code></td></tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+function filter() {
+	var cls = document.getElementById("class").value;
+	var dom = document.getElementById("domain").value.toLowerCase();
+
+	document.querySelectorAll("tr[data-class]").forEach(function (tr) {
+		var show = (cls === "" || tr.dataset.class === cls) &&
+			tr.dataset.domain.indexOf(dom) >= 0;
+
+		tr.classList.toggle("hidden", !show);
+	});
+}
+
+document.getElementById("class").addEventListener("change", filter);
+document.getElementById("domain").addEventListener("input", filter);
+
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+	th.addEventListener("click", function () {
+		var tbody = th.closest("table").tBodies[0];
+		var col = th.cellIndex;
+		var asc = th.dataset.order !== "asc";
+		var rows = Array.from(tbody.rows);
+
+		rows.sort(function (a, b) {
+			var x = a.cells[col].textContent;
+			var y = b.cells[col].textContent;
+			var c = x !== "" && y !== "" && !isNaN(x) && !isNaN(y) ?
+				x - y : x.localeCompare(y);
+
+			return asc ? c : -c;
+		});
+
+		th.closest("tr").querySelectorAll("th").forEach(function (h) {
+			delete h.dataset.order;
+		});
+		th.dataset.order = asc ? "asc" : "desc";
+		rows.forEach(function (tr) { tbody.appendChild(tr); });
+	});
+});
+</script>
+</body>
+</html>
+`))
+
+// classCount is the number of names of a classification.
+type classCount struct {
+	Class string
+	Names int
+}
+
+// source is a line of the hosts file.
+type source struct {
+	Line int
+	Text string
+}
+
+// htmlWriter writes an HTML report of the records when closed.
+type htmlWriter struct {
+	w       io.Writer
+	s       *Summary
+	records []*Record
+	sources []source
+}
+
+func newHTMLWriter(w io.Writer) *htmlWriter {
+	return &htmlWriter{w: w, s: NewSummary()}
+}
+
+func (hw *htmlWriter) Write(rec *Record) error {
+	hw.s.Add(rec)
+	hw.records = append(hw.records, rec)
+
+	// Records are written in the order of the lines.
+	if n := len(hw.sources); n == 0 || hw.sources[n-1].Line != rec.Line {
+		hw.sources = append(hw.sources, source{Line: rec.Line, Text: rec.Source})
+	}
+
+	return nil
+}
+
+func (hw *htmlWriter) Close() error {
+	counts := make([]classCount, 0, len(Classes))
+
+	for _, c := range Classes {
+		counts = append(counts, classCount{string(c), hw.s.Classes[c]})
+	}
+
+	return page.Execute(hw.w, struct {
+		*Summary
+		Counts  []classCount
+		Records []*Record
+		Sources []source
+	}{hw.s, counts, hw.records, hw.sources})
+}
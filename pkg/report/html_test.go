@@ -0,0 +1,48 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/report"
+)
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, _ := report.NewWriter(&buf, report.FormatHTML)
+
+	for _, rec := range records {
+		assert.NoError(t, w.Write(rec))
+	}
+
+	assert.NoError(t, w.Write(&report.Record{
+		Name:   "<script>.e.com",
+		Line:   6,
+		Source: "0.0.0.0 <script>.e.com",
+		Entry:  "<script>.e.com",
+		Class:  check.Error,
+		Error:  "<b>",
+	}))
+	assert.Equal(t, 0, buf.Len())
+	assert.NoError(t, w.Close())
+
+	html := buf.String()
+
+	assert.Contains(t, html, "<h2>New leaks (3)</h2>")
+	assert.Contains(t, html, "<h2>Dead entries (1)</h2>")
+	assert.Contains(t, html, "<h2>Wildcard zones (1)</h2>")
+	assert.Contains(t, html, "<h2>Errors (3)</h2>")
+	assert.Contains(t, html, `<tr data-class="resolves" data-domain="b.co.uk"><td>x.b.co.uk</td>`)
+	assert.Contains(t, html, `<a href="#L4">4</a>`)
+	assert.Contains(t, html, `<tr id="L6">`)
+	assert.Contains(t, html, "&lt;script&gt;.e.com")
+	assert.NotContains(t, html, "<script>.e.com")
+	assert.NotContains(t, html, "<b>\n")
+	assert.NotContains(t, html, "src=")
+	assert.NotContains(t, html, "<link")
+	assert.Equal(t, 6, bytes.Count(buf.Bytes(), []byte("<tr id=\"L")))
+}
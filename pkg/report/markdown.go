@@ -0,0 +1,98 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// topDomains is the number of domains listed in a Markdown summary.
+const topDomains = 10
+
+// markdownWriter writes a Markdown summary of the records when closed.
+type markdownWriter struct {
+	w io.Writer
+	s *Summary
+}
+
+func newMarkdownWriter(w io.Writer) *markdownWriter {
+	return &markdownWriter{w: w, s: NewSummary()}
+}
+
+func (mw *markdownWriter) Write(rec *Record) error {
+	mw.s.Add(rec)
+
+	return nil
+}
+
+func (mw *markdownWriter) Close() error {
+	var b strings.Builder
+
+	s := mw.s
+
+	b.WriteString("## lpc summary\n\n")
+	b.WriteString("| Classification | Names |\n| --- | ---: |\n")
+
+	for _, c := range Classes {
+		fmt.Fprintf(&b, "| %s | %d |\n", c, s.Classes[c])
+	}
+
+	fmt.Fprintf(&b, "| **total** | **%d** |\n", s.Total)
+
+	fmt.Fprintf(&b, "\n### Leaks (%d)\n\n", len(s.Leaks))
+
+	if top := s.TopDomains(topDomains); len(top) > 0 {
+		b.WriteString("| Domain | Leaks |\n| --- | ---: |\n")
+
+		for _, d := range top {
+			fmt.Fprintf(&b, "| %s | %d |\n", cell(d.Domain), d.Leaks)
+		}
+	} else {
+		b.WriteString("None.\n")
+	}
+
+	fmt.Fprintf(&b, "\n### Dead entries (%d)\n\n", len(s.Dead))
+
+	if len(s.Dead) > 0 {
+		b.WriteString("| Entry | Line |\n| --- | ---: |\n")
+
+		for _, rec := range s.Dead {
+			fmt.Fprintf(&b, "| %s | %d |\n", cell(rec.Name), rec.Line)
+		}
+	} else {
+		b.WriteString("None.\n")
+	}
+
+	fmt.Fprintf(&b, "\n### Errors (%d)\n\n", len(s.Errors))
+
+	if len(s.Errors) > 0 {
+		b.WriteString("| Name | Line | Error |\n| --- | ---: | --- |\n")
+
+		for _, rec := range s.Errors {
+			msg := rec.Error
+
+			if msg == "" {
+				msg = rec.Rcode
+			}
+
+			fmt.Fprintf(
+				&b,
+				"| %s | %d | %s |\n",
+				cell(rec.Name),
+				rec.Line,
+				cell(msg),
+			)
+		}
+	} else {
+		b.WriteString("None.\n")
+	}
+
+	_, err := io.WriteString(mw.w, b.String())
+
+	return err
+}
+
+// cell escapes s for a Markdown table cell.
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,36 @@
+package report_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/report"
+)
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, _ := report.NewWriter(&buf, report.FormatMarkdown)
+
+	for _, rec := range records {
+		assert.NoError(t, w.Write(rec))
+	}
+
+	assert.Equal(t, 0, buf.Len())
+	assert.NoError(t, w.Close())
+
+	md := buf.String()
+
+	assert.Contains(t, md, "| resolves | 6 |\n")
+	assert.Contains(t, md, "| **total** | **10** |\n")
+	assert.Contains(t, md, "### Leaks (3)\n\n| Domain | Leaks |\n| --- | ---: |\n| a.com | 2 |\n| b.co.uk | 1 |\n")
+	assert.Contains(t, md, "### Dead entries (1)\n\n| Entry | Line |\n| --- | ---: |\n| gone.c.net | 4 |\n")
+	assert.Contains(t, md, "| d.org | 5 | SERVFAIL |\n| www.d.org | 5 | i/o timeout |\n")
+
+	buf.Reset()
+	w, _ = report.NewWriter(&buf, report.FormatMarkdown)
+	assert.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "### Errors (0)\n\nNone.\n")
+}
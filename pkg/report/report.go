@@ -0,0 +1,209 @@
+// Package report writes the machine readable reports of the checked names.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// Formats of a report.
+const (
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Record is the outcome of the query for a checked name.
+type Record struct {
+	Name string `json:"name"`
+	// Line is the line of the hosts file the name comes from.
+	Line int `json:"line"`
+	// Source is the text of the line.
+	Source string `json:"source,omitempty"`
+	// Entry is the hosts entry the name is derived from.
+	Entry string `json:"entry"`
+	// Prefix is the prefix added to the entry, empty for the entry itself.
+	Prefix string   `json:"prefix,omitempty"`
+	Qtypes []string `json:"qtypes"`
+	Rcode  string   `json:"rcode,omitempty"`
+	// Answers are the data of the answer records of the query types.
+	Answers []string `json:"answers,omitempty"`
+	// CNAMEs are the targets of the CNAME chain in order.
+	CNAMEs    []string    `json:"cnames,omitempty"`
+	Class     check.Class `json:"class"`
+	Upstream  string      `json:"upstream,omitempty"`
+	Transport string      `json:"transport,omitempty"`
+	// RTT is the round trip time of the response, and Elapsed the time
+	// taken by the query including retries, in milliseconds.
+	RTT     float64 `json:"rtt_ms"`
+	Elapsed float64 `json:"elapsed_ms"`
+	// DNSSEC is the DNSSEC status if it was requested.
+	DNSSEC string `json:"dnssec,omitempty"`
+	// Scope is the client subnet the answer is valid for.
+	Scope string `json:"scope,omitempty"`
+	// Added reports whether the prefixed name was added to the hosts output.
+	Added bool `json:"added"`
+	// Wildcard reports whether every name under the entry resolves, if it
+	// was checked.
+	Wildcard bool   `json:"wildcard,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ms returns d in milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// NewRecord returns the record of the query for c from line, answered with
+// res or failed with err after elapsed.
+func NewRecord(
+	c check.Candidate,
+	line int,
+	prefix string,
+	res *resolver.Result,
+	err error,
+	elapsed time.Duration,
+	s check.Sinkholes,
+) *Record {
+	rec := &Record{
+		Name:    c.Name,
+		Line:    line,
+		Entry:   c.From,
+		Qtypes:  []string{dns.TypeToString[c.Qtype]},
+		Elapsed: ms(elapsed),
+	}
+
+	if c.Prefixed() {
+		rec.Prefix = prefix
+	}
+
+	if err != nil {
+		rec.Class = check.Error
+		rec.Error = err.Error()
+
+		return rec
+	}
+
+	m := res.Msg
+
+	rec.Rcode = dns.RcodeToString[m.Rcode]
+	rec.Class = check.Classify(m, s)
+	rec.Upstream = res.Upstream
+	rec.Transport = res.Transport
+	rec.RTT = ms(res.RTT)
+
+	if res.Scope.IsValid() {
+		rec.Scope = res.Scope.String()
+	}
+
+	for _, rr := range m.Answer {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			rec.CNAMEs = append(rec.CNAMEs, rr.Target)
+		case *dns.A:
+			rec.Answers = append(rec.Answers, rr.A.String())
+		case *dns.AAAA:
+			rec.Answers = append(rec.Answers, rr.AAAA.String())
+		default:
+			if rr.Header().Rrtype == c.Qtype {
+				rec.Answers = append(
+					rec.Answers,
+					strings.TrimPrefix(rr.String(), rr.Header().String()),
+				)
+			}
+		}
+	}
+
+	return rec
+}
+
+// Writer writes the records of a report.
+type Writer interface {
+	Write(rec *Record) error
+	// Close ends the report without closing the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer of a report in format to w.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: w, array: true}, nil
+	case FormatNDJSON:
+		return &jsonWriter{w: w}, nil
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatMarkdown:
+		return newMarkdownWriter(w), nil
+	case FormatHTML:
+		return newHTMLWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// jsonWriter writes a JSON array of the records, or a record on each line.
+type jsonWriter struct {
+	w     io.Writer
+	array bool
+	n     int
+}
+
+func (jw *jsonWriter) Write(rec *Record) error {
+	b, err := json.Marshal(rec)
+
+	if err != nil {
+		return err
+	}
+
+	sep := "\n"
+
+	if jw.array {
+		if jw.n == 0 {
+			sep = "[\n"
+		} else {
+			sep = ",\n"
+		}
+	}
+
+	if jw.n == 0 && !jw.array {
+		sep = ""
+	}
+
+	jw.n++
+
+	if _, err := io.WriteString(jw.w, sep); err != nil {
+		return err
+	}
+
+	_, err = jw.w.Write(b)
+
+	return err
+}
+
+func (jw *jsonWriter) Close() error {
+	end := "\n"
+
+	switch {
+	case jw.array && jw.n == 0:
+		end = "[]\n"
+	case jw.array:
+		end = "\n]\n"
+	case jw.n == 0:
+		end = ""
+	}
+
+	_, err := io.WriteString(jw.w, end)
+
+	return err
+}
@@ -0,0 +1,203 @@
+package report_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/report"
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// result builds a result with rcode and the answer records.
+func result(rcode int, answer ...string) *resolver.Result {
+	m := new(dns.Msg)
+	m.SetQuestion("www.a.com.", dns.TypeA)
+	m.Response = true
+	m.Rcode = rcode
+
+	for _, s := range answer {
+		rr, _ := dns.NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+
+	return &resolver.Result{
+		Msg:       m,
+		Upstream:  "192.0.2.53:53",
+		Transport: resolver.TransportUDP,
+		RTT:       1500 * time.Microsecond,
+	}
+}
+
+func TestNewRecord(t *testing.T) {
+	s, _ := check.ParseSinkholes(check.DefaultSinkholes)
+	pfx := check.Candidate{Name: "www.a.com", Qtype: dns.TypeA, From: "a.com"}
+
+	tests := []struct {
+		name string
+		c    check.Candidate
+		res  *resolver.Result
+		err  error
+		want *report.Record
+	}{
+		{
+			name: "resolves",
+			c:    pfx,
+			res: result(
+				dns.RcodeSuccess,
+				"www.a.com. 60 IN CNAME cdn.b.net.",
+				"cdn.b.net. 60 IN CNAME edge.b.net.",
+				"edge.b.net. 60 IN A 192.0.2.1",
+			),
+			want: &report.Record{
+				Name:      "www.a.com",
+				Line:      3,
+				Entry:     "a.com",
+				Prefix:    "www.",
+				Qtypes:    []string{"A"},
+				Rcode:     "NOERROR",
+				Answers:   []string{"192.0.2.1"},
+				CNAMEs:    []string{"cdn.b.net.", "edge.b.net."},
+				Class:     check.Resolves,
+				Upstream:  "192.0.2.53:53",
+				Transport: resolver.TransportUDP,
+				RTT:       1.5,
+				Elapsed:   2,
+			},
+		},
+		{
+			name: "entry",
+			c:    check.Candidate{Name: "a.com", Qtype: dns.TypeA, From: "a.com"},
+			res:  result(dns.RcodeNameError),
+			want: &report.Record{
+				Name:      "a.com",
+				Line:      3,
+				Entry:     "a.com",
+				Qtypes:    []string{"A"},
+				Rcode:     "NXDOMAIN",
+				Class:     check.NXDomain,
+				Upstream:  "192.0.2.53:53",
+				Transport: resolver.TransportUDP,
+				RTT:       1.5,
+				Elapsed:   2,
+			},
+		},
+		{
+			name: "error",
+			c:    pfx,
+			err:  errors.New("i/o timeout"),
+			want: &report.Record{
+				Name:    "www.a.com",
+				Line:    3,
+				Entry:   "a.com",
+				Prefix:  "www.",
+				Qtypes:  []string{"A"},
+				Class:   check.Error,
+				Elapsed: 2,
+				Error:   "i/o timeout",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(
+				t,
+				tt.want,
+				report.NewRecord(
+					tt.c,
+					3,
+					"www.",
+					tt.res,
+					tt.err,
+					2*time.Millisecond,
+					s,
+				),
+			)
+		})
+	}
+}
+
+func TestNewRecordScope(t *testing.T) {
+	res := result(dns.RcodeSuccess, "www.a.com. 60 IN A 192.0.2.1")
+	res.Scope = netip.MustParsePrefix("198.51.100.0/24")
+
+	rec := report.NewRecord(
+		check.Candidate{Name: "www.a.com", Qtype: dns.TypeA, From: "a.com"},
+		1,
+		"www.",
+		res,
+		nil,
+		0,
+		nil,
+	)
+
+	assert.Equal(t, "198.51.100.0/24", rec.Scope)
+}
+
+func TestWriter(t *testing.T) {
+	recs := []*report.Record{
+		{Name: "a.com", Line: 1, Entry: "a.com", Class: check.NXDomain},
+		{Name: "www.a.com", Line: 1, Entry: "a.com", Class: check.Resolves},
+	}
+
+	tests := []struct {
+		name   string
+		format string
+		recs   []*report.Record
+	}{
+		{name: "json", format: report.FormatJSON, recs: recs},
+		{name: "json empty", format: report.FormatJSON},
+		{name: "ndjson", format: report.FormatNDJSON, recs: recs},
+		{name: "ndjson empty", format: report.FormatNDJSON},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			w, err := report.NewWriter(&buf, tt.format)
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			for _, rec := range tt.recs {
+				assert.NoError(t, w.Write(rec))
+			}
+
+			assert.NoError(t, w.Close())
+
+			var got []*report.Record
+
+			if tt.format == report.FormatJSON {
+				assert.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+			} else {
+				scn := bufio.NewScanner(&buf)
+
+				for scn.Scan() {
+					var rec report.Record
+
+					assert.NoError(t, json.Unmarshal(scn.Bytes(), &rec))
+					got = append(got, &rec)
+				}
+			}
+
+			assert.Equal(t, len(tt.recs), len(got))
+
+			for i, rec := range tt.recs {
+				assert.Equal(t, rec.Name, got[i].Name)
+				assert.Equal(t, rec.Class, got[i].Class)
+			}
+		})
+	}
+
+	_, err := report.NewWriter(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package report
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/mys721tx/lpc/pkg/check"
+)
+
+// Classes are the classifications of a summary in order.
+var Classes = []check.Class{
+	check.Resolves,
+	check.Filtered,
+	check.NXDomain,
+	check.Failed,
+	check.Error,
+}
+
+// Summary aggregates the records of a run for reviewers.
+type Summary struct {
+	Total   int
+	Classes map[check.Class]int
+	// Leaks are the prefixed names added to the hosts output.
+	Leaks []*Record
+	// Wildcards are the leaks of entries answering every name under them.
+	Wildcards []*Record
+	// Dead are the entries that do not exist.
+	Dead []*Record
+	// Errors are the names failed or without a response.
+	Errors []*Record
+}
+
+// NewSummary returns an empty Summary.
+func NewSummary() *Summary {
+	return &Summary{Classes: make(map[check.Class]int)}
+}
+
+// Add counts rec in the summary.
+func (s *Summary) Add(rec *Record) {
+	s.Total++
+	s.Classes[rec.Class]++
+
+	switch {
+	case rec.Added:
+		s.Leaks = append(s.Leaks, rec)
+
+		if rec.Wildcard {
+			s.Wildcards = append(s.Wildcards, rec)
+		}
+	case rec.Class == check.NXDomain && rec.Name == rec.Entry:
+		s.Dead = append(s.Dead, rec)
+	case rec.Class == check.Failed || rec.Class == check.Error:
+		s.Errors = append(s.Errors, rec)
+	}
+}
+
+// DomainCount is the number of leaks of a registrable domain.
+type DomainCount struct {
+	Domain string
+	Leaks  int
+}
+
+// TopDomains returns the n registrable domains with the most leaks, all of
+// them if n is 0.
+func (s *Summary) TopDomains(n int) []DomainCount {
+	counts := make(map[string]int)
+
+	for _, rec := range s.Leaks {
+		counts[Registrable(rec.Entry)]++
+	}
+
+	top := make([]DomainCount, 0, len(counts))
+
+	for d, c := range counts {
+		top = append(top, DomainCount{Domain: d, Leaks: c})
+	}
+
+	slices.SortFunc(top, func(a, b DomainCount) int {
+		if c := cmp.Compare(b.Leaks, a.Leaks); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Domain, b.Domain)
+	})
+
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+
+	return top
+}
+
+// Registrable returns the registrable domain of name from the public suffix
+// list, or name itself if it is a public suffix.
+func Registrable(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	d, err := publicsuffix.EffectiveTLDPlusOne(name)
+
+	if err != nil {
+		return name
+	}
+
+	return d
+}
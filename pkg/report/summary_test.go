@@ -0,0 +1,102 @@
+package report_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/report"
+)
+
+// records are the records of a run on three entries.
+var records = []*report.Record{
+	{Name: "ads.a.com", Line: 1, Entry: "ads.a.com", Class: check.Resolves},
+	{
+		Name:   "www.ads.a.com",
+		Line:   1,
+		Entry:  "ads.a.com",
+		Prefix: "www.",
+		Class:  check.Resolves,
+		Added:  true,
+	},
+	{Name: "t.a.com", Line: 2, Entry: "t.a.com", Class: check.Resolves},
+	{
+		Name:   "www.t.a.com",
+		Line:   2,
+		Entry:  "t.a.com",
+		Prefix: "www.",
+		Class:  check.Resolves,
+		Added:  true,
+	},
+	{Name: "x.b.co.uk", Line: 3, Entry: "x.b.co.uk", Class: check.Resolves},
+	{
+		Name:     "www.x.b.co.uk",
+		Line:     3,
+		Entry:    "x.b.co.uk",
+		Prefix:   "www.",
+		Class:    check.Resolves,
+		Added:    true,
+		Wildcard: true,
+	},
+	{Name: "gone.c.net", Line: 4, Entry: "gone.c.net", Class: check.NXDomain},
+	{
+		Name:   "www.gone.c.net",
+		Line:   4,
+		Entry:  "gone.c.net",
+		Prefix: "www.",
+		Class:  check.NXDomain,
+	},
+	{Name: "d.org", Line: 5, Entry: "d.org", Class: check.Failed, Rcode: "SERVFAIL"},
+	{
+		Name:   "www.d.org",
+		Line:   5,
+		Entry:  "d.org",
+		Prefix: "www.",
+		Class:  check.Error,
+		Error:  "i/o timeout",
+	},
+}
+
+func TestSummary(t *testing.T) {
+	s := report.NewSummary()
+
+	for _, rec := range records {
+		s.Add(rec)
+	}
+
+	assert.Equal(t, 10, s.Total)
+	assert.Equal(t, 6, s.Classes[check.Resolves])
+	assert.Equal(t, 2, s.Classes[check.NXDomain])
+	assert.Len(t, s.Leaks, 3)
+	assert.Len(t, s.Wildcards, 1)
+	assert.Len(t, s.Dead, 1)
+	assert.Equal(t, "gone.c.net", s.Dead[0].Name)
+	assert.Len(t, s.Errors, 2)
+	assert.Equal(t, []report.DomainCount{
+		{Domain: "a.com", Leaks: 2},
+		{Domain: "b.co.uk", Leaks: 1},
+	}, s.TopDomains(0))
+	assert.Equal(t, []report.DomainCount{
+		{Domain: "a.com", Leaks: 2},
+	}, s.TopDomains(1))
+}
+
+func TestRegistrable(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "subdomain", host: "ads.example.com", want: "example.com"},
+		{name: "fqdn", host: "Ads.Example.COM.", want: "example.com"},
+		{name: "multiLabelSuffix", host: "a.b.example.co.uk", want: "example.co.uk"},
+		{name: "privateSuffix", host: "x.user.github.io", want: "user.github.io"},
+		{name: "suffix", host: "co.uk", want: "co.uk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, report.Registrable(tt.host))
+		})
+	}
+}
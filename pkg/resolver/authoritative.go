@@ -0,0 +1,261 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAME is the longest CNAME chain followed.
+const maxCNAME = 8
+
+// errNoAnswer is returned when no nameserver answers authoritatively.
+var errNoAnswer = errors.New("no authoritative answer")
+
+// Authoritative is a Resolver asking the authoritative nameservers of each
+// zone directly without recursion. The nameservers are looked up from a
+// recursive Resolver, which also answers when they fail.
+type Authoritative struct {
+	Recursive Resolver
+	// Client is the template of the queries to the nameservers.
+	Client Client
+	// Port is the port of the nameservers.
+	Port string
+	// Direct and Fallbacks count the queries answered by the nameservers
+	// and by the recursive Resolver.
+	Direct, Fallbacks int
+
+	mu sync.Mutex
+	// zones maps a name to the nameserver addresses of its zone, or to nil
+	// if the name is not a zone.
+	zones map[string][]string
+}
+
+// NewAuthoritative returns an Authoritative looking up the nameservers from
+// r and querying them with a copy of c.
+func NewAuthoritative(r Resolver, c Client) *Authoritative {
+	return &Authoritative{
+		Recursive: r,
+		Client:    c,
+		Port:      "53",
+		zones:     make(map[string][]string),
+	}
+}
+
+// Resolve queries the authoritative nameservers of the zone of name, and
+// the recursive Resolver if they fail. A CNAME to another zone is followed.
+func (a *Authoritative) Resolve(name string, qtype uint16) (*Result, error) {
+	res, err := a.direct(dns.Fqdn(name), qtype, 0)
+
+	a.mu.Lock()
+
+	if err == nil {
+		a.Direct++
+	} else {
+		a.Fallbacks++
+	}
+
+	a.mu.Unlock()
+
+	if err == nil {
+		return res, nil
+	}
+
+	return a.Recursive.Resolve(name, qtype)
+}
+
+// direct resolves name from its authoritative nameservers.
+func (a *Authoritative) direct(name string, qtype uint16, depth int) (*Result, error) {
+	if depth > maxCNAME {
+		return nil, fmt.Errorf("CNAME chain of %s too long", name)
+	}
+
+	servers, err := a.nameservers(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var res *Result
+	err = errNoAnswer
+
+	for _, addr := range servers {
+		c := a.Client
+		c.Addr = addr
+		c.NoRecursion = true
+
+		res, err = c.Resolve(name, qtype)
+
+		if err == nil && !res.Msg.Authoritative {
+			// A referral or a lame server.
+			err = fmt.Errorf("%s is not authoritative for %s", addr, name)
+		}
+
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	target := ""
+
+	for _, rr := range res.Msg.Answer {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			if strings.EqualFold(rr.Hdr.Name, name) {
+				target = rr.Target
+			}
+		default:
+			if rr.Header().Rrtype == qtype {
+				return res, nil
+			}
+		}
+	}
+
+	if target == "" || qtype == dns.TypeCNAME {
+		return res, nil
+	}
+
+	// Follow the CNAME unless the nameserver already did so.
+	for _, rr := range res.Msg.Answer {
+		if strings.EqualFold(rr.Header().Name, target) {
+			return res, nil
+		}
+	}
+
+	next, err := a.direct(target, qtype, depth+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res.Msg.Answer = append(res.Msg.Answer, next.Msg.Answer...)
+	res.Msg.Rcode = next.Msg.Rcode
+
+	return res, nil
+}
+
+// nameservers returns the nameserver addresses of the zone of name.
+func (a *Authoritative) nameservers(name string) ([]string, error) {
+	for cur := dns.CanonicalName(name); ; {
+		a.mu.Lock()
+		servers, ok := a.zones[cur]
+		a.mu.Unlock()
+
+		if !ok {
+			var zone string
+			var err error
+
+			zone, servers, err = a.lookup(cur)
+
+			if err != nil {
+				return nil, err
+			}
+
+			a.mu.Lock()
+
+			if servers != nil {
+				a.zones[zone] = servers
+			} else {
+				a.zones[cur] = nil
+			}
+
+			a.mu.Unlock()
+
+			if zone != cur && zone != "" {
+				// The SOA in the authority section names the zone.
+				cur = zone
+				continue
+			}
+		}
+
+		if servers != nil {
+			return servers, nil
+		}
+
+		if cur == "." {
+			return nil, errors.New("no nameserver for the root zone")
+		}
+
+		if off, end := dns.NextLabel(cur, 0); end {
+			cur = "."
+		} else {
+			cur = cur[off:]
+		}
+	}
+}
+
+// lookup queries the NS records of name. It returns the zone of name if
+// known, and its nameserver addresses if name is the zone.
+func (a *Authoritative) lookup(name string) (string, []string, error) {
+	res, err := a.Recursive.Resolve(name, dns.TypeNS)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	var hosts []string
+
+	for _, rr := range res.Msg.Answer {
+		if ns, ok := rr.(*dns.NS); ok && strings.EqualFold(ns.Hdr.Name, name) {
+			hosts = append(hosts, ns.Ns)
+		}
+	}
+
+	if len(hosts) == 0 {
+		for _, rr := range res.Msg.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				zone := dns.CanonicalName(soa.Hdr.Name)
+
+				if dns.IsSubDomain(zone, name) {
+					return zone, nil, nil
+				}
+			}
+		}
+
+		return "", nil, nil
+	}
+
+	var servers []string
+
+	for _, host := range hosts {
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			res, err := a.Recursive.Resolve(host, qtype)
+
+			if err != nil {
+				continue
+			}
+
+			for _, rr := range res.Msg.Answer {
+				var ip net.IP
+
+				switch rr := rr.(type) {
+				case *dns.A:
+					ip = rr.A
+				case *dns.AAAA:
+					ip = rr.AAAA
+				default:
+					continue
+				}
+
+				servers = append(
+					servers,
+					net.JoinHostPort(ip.String(), a.Port),
+				)
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return "", nil, fmt.Errorf("no address for the nameservers of %s", name)
+	}
+
+	return name, servers, nil
+}
@@ -0,0 +1,217 @@
+package resolver_test
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// zoneHandler answers authoritatively from records, with the SOA of the
+// zone for names without records.
+func zoneHandler(records ...string) dns.HandlerFunc {
+	rrs := make(map[string][]dns.RR)
+	var soas []dns.RR
+
+	for _, s := range records {
+		rr, _ := dns.NewRR(s)
+		name := dns.CanonicalName(rr.Header().Name)
+		rrs[name] = append(rrs[name], rr)
+
+		if rr.Header().Rrtype == dns.TypeSOA {
+			soas = append(soas, rr)
+		}
+	}
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		q := r.Question[0]
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Authoritative = true
+
+		for _, rr := range rrs[dns.CanonicalName(q.Name)] {
+			t := rr.Header().Rrtype
+
+			if t == q.Qtype || t == dns.TypeCNAME {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+
+		if len(m.Answer) == 0 {
+			if _, ok := rrs[dns.CanonicalName(q.Name)]; !ok {
+				m.Rcode = dns.RcodeNameError
+			}
+
+			for _, soa := range soas {
+				if dns.IsSubDomain(soa.Header().Name, q.Name) {
+					m.Ns = append(m.Ns, soa)
+				}
+			}
+		}
+
+		w.WriteMsg(m)
+	}
+}
+
+// recursive answers like a recursive resolver from the zone handler zh,
+// except for address queries outside the nameservers, which get 192.0.2.99,
+// and counts the NS queries.
+type recursive struct {
+	mu sync.Mutex
+	ns map[string]int
+	zh dns.HandlerFunc
+}
+
+// queries returns the number of NS queries for name.
+func (h *recursive) queries(name string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.ns[name]
+}
+
+func (h *recursive) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+
+	if q.Qtype == dns.TypeNS {
+		h.mu.Lock()
+		h.ns[q.Name]++
+		h.mu.Unlock()
+	}
+
+	if q.Qtype == dns.TypeA && !strings.HasPrefix(q.Name, "ns.") {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		rr, _ := dns.NewRR(q.Name + " 60 IN A 192.0.2.99")
+		m.Answer = append(m.Answer, rr)
+
+		w.WriteMsg(m)
+
+		return
+	}
+
+	h.zh(&unauthoritative{w}, r)
+}
+
+// unauthoritative clears the AA bit of the responses.
+type unauthoritative struct {
+	dns.ResponseWriter
+}
+
+func (w *unauthoritative) WriteMsg(m *dns.Msg) error {
+	m.Authoritative = false
+
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+var zones = []string{
+	"example. 3600 IN SOA ns.example. admin.example. 1 3600 600 86400 300",
+	"example. 3600 IN NS ns.example.",
+	"ns.example. 3600 IN A 127.0.0.1",
+	"a.example. 60 IN A 192.0.2.1",
+	"c.example. 60 IN CNAME a.other.",
+	"other. 3600 IN SOA ns.example. admin.example. 1 3600 600 86400 300",
+	"other. 3600 IN NS ns.example.",
+	"a.other. 60 IN A 192.0.2.2",
+}
+
+func TestAuthoritative(t *testing.T) {
+	auth := serve(t, zoneHandler(zones...))
+	_, authPort, _ := net.SplitHostPort(auth)
+
+	rec := &recursive{ns: make(map[string]int), zh: zoneHandler(zones...)}
+	recAddr := serve(t, rec.ServeDNS)
+
+	a := resolver.NewAuthoritative(
+		resolver.NewClient(recAddr, time.Second, 0),
+		resolver.Client{Timeout: time.Second},
+	)
+	a.Port = authPort
+
+	tests := []struct {
+		name   string
+		qname  string
+		rcode  int
+		answer []string
+	}{
+		{
+			name:   "answer",
+			qname:  "a.example",
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"192.0.2.1"},
+		},
+		{
+			name:   "nxdomain",
+			qname:  "b.example",
+			rcode:  dns.RcodeNameError,
+			answer: nil,
+		},
+		{
+			name:   "cname",
+			qname:  "c.example",
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"a.other.", "192.0.2.2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := a.Resolve(tt.qname, dns.TypeA)
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.rcode, res.Msg.Rcode)
+			assert.True(t, res.Msg.Authoritative)
+
+			var answer []string
+
+			for _, rr := range res.Msg.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					answer = append(answer, rr.A.String())
+				case *dns.CNAME:
+					answer = append(answer, rr.Target)
+				}
+			}
+
+			assert.Equal(t, tt.answer, answer)
+		})
+	}
+
+	assert.Equal(t, 3, a.Direct)
+	assert.Equal(t, 0, a.Fallbacks)
+	assert.Equal(t, 1, rec.queries("example."))
+	assert.Equal(t, 1, rec.queries("other."))
+}
+
+func TestAuthoritativeFallback(t *testing.T) {
+	rec := &recursive{ns: make(map[string]int), zh: zoneHandler(zones...)}
+	recAddr := serve(t, rec.ServeDNS)
+	_, recPort, _ := net.SplitHostPort(recAddr)
+
+	// The nameservers are not authoritative on the port of the recursive
+	// resolver.
+	a := resolver.NewAuthoritative(
+		resolver.NewClient(recAddr, time.Second, 0),
+		resolver.Client{Timeout: time.Second},
+	)
+	a.Port = recPort
+
+	res, err := a.Resolve("a.example", dns.TypeA)
+
+	if assert.NoError(t, err) && assert.Len(t, res.Msg.Answer, 1) {
+		assert.Equal(t, "192.0.2.99", res.Msg.Answer[0].(*dns.A).A.String())
+	}
+
+	assert.Equal(t, 0, a.Direct)
+	assert.Equal(t, 1, a.Fallbacks)
+}
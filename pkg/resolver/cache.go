@@ -0,0 +1,359 @@
+package resolver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TransportCache is the transport of a Result answered from a Cache.
+const TransportCache = "cache"
+
+// ErrCacheMiss is returned by a cache-only Cache for a query it has no entry
+// for.
+var ErrCacheMiss = errors.New("not in cache")
+
+// entry is a cached response, stored as one JSON line.
+type entry struct {
+	Name     string    `json:"name"`
+	Qtype    string    `json:"qtype"`
+	Options  string    `json:"options,omitempty"`
+	Rcode    int       `json:"rcode"`
+	AD       bool      `json:"ad,omitempty"`
+	Answer   []string  `json:"answer,omitempty"`
+	Ns       []string  `json:"ns,omitempty"`
+	Scope    string    `json:"scope,omitempty"`
+	Upstream string    `json:"upstream"`
+	Stored   time.Time `json:"stored"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Cache is a Resolver answering from responses previously returned by
+// another Resolver until their TTL expires. Negative responses are cached
+// for the SOA minimum of RFC 2308. Errors and other rcodes are not cached.
+type Cache struct {
+	Resolver Resolver
+	// Options describe the queries of the Resolver, such as the DO and CD
+	// bits, the client subnet and the upstreams. Only the entries stored
+	// with the same Options answer.
+	Options string
+	// MaxAge limits the age of the entries used and kept if it is not zero.
+	MaxAge time.Duration
+	// Only answers from the entries without querying the Resolver, even if
+	// their TTL expired, and returns ErrCacheMiss otherwise.
+	Only bool
+	// Refresh queries the Resolver for every name and replaces the entries.
+	Refresh bool
+	// Now returns the current time.
+	Now func() time.Time
+	// Hits and Misses count the queries answered from the entries and by
+	// the Resolver.
+	Hits, Misses int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	dirty   bool
+}
+
+// NewCache returns an empty Cache in front of r.
+func NewCache(r Resolver) *Cache {
+	return &Cache{
+		Resolver: r,
+		Now:      time.Now,
+		entries:  make(map[string]*entry),
+	}
+}
+
+// LoadCache returns a Cache in front of r with the entries stored at path.
+// A missing file is an empty Cache.
+func LoadCache(r Resolver, path string) (*Cache, error) {
+	c := NewCache(r)
+
+	f, err := os.Open(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	scn := bufio.NewScanner(f)
+	scn.Buffer(nil, dns.MaxMsgSize*4)
+
+	for n := 1; scn.Scan(); n++ {
+		e := new(entry)
+
+		if err := json.Unmarshal(scn.Bytes(), e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		c.entries[cacheKey(e.Name, e.Qtype, e.Options)] = e
+	}
+
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// key returns the key of the entry for name and qtype.
+func key(name, qtype string) string {
+	return dns.CanonicalName(dns.Fqdn(name)) + "/" + qtype
+}
+
+// cacheKey returns the key of the entry for name and qtype queried with
+// options.
+func cacheKey(name, qtype, options string) string {
+	return key(name, qtype) + "/" + options
+}
+
+// Resolve answers from the entry for name if it is fresh, and queries the
+// Resolver otherwise.
+func (c *Cache) Resolve(name string, qtype uint16) (*Result, error) {
+	k := cacheKey(name, dns.TypeToString[qtype], c.Options)
+	now := c.Now()
+
+	c.mu.Lock()
+	e := c.entries[k]
+
+	if e != nil && !c.Refresh && c.fresh(e, now) {
+		c.Hits++
+		c.mu.Unlock()
+
+		return e.result(name, qtype, now)
+	}
+
+	c.mu.Unlock()
+
+	if c.Only {
+		return nil, fmt.Errorf("%w: %s %s", ErrCacheMiss, name, dns.TypeToString[qtype])
+	}
+
+	res, err := c.Resolver.Resolve(name, qtype)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Misses++
+
+	if err != nil {
+		return nil, err
+	}
+
+	if e := newEntry(k, c.Options, res, now); e != nil {
+		c.entries[k] = e
+		c.dirty = true
+	}
+
+	return res, nil
+}
+
+// fresh reports whether e can answer at now.
+func (c *Cache) fresh(e *entry, now time.Time) bool {
+	if c.MaxAge > 0 && now.Sub(e.Stored) > c.MaxAge {
+		return false
+	}
+
+	return c.Only || now.Before(e.Expires)
+}
+
+// Save writes the entries to path if any entry was added. Expired entries are
+// kept for Only, and entries older than MaxAge are dropped. The file is
+// replaced atomically.
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	now := c.Now()
+
+	for _, e := range c.entries {
+		if c.MaxAge > 0 && now.Sub(e.Stored) > c.MaxAge {
+			continue
+		}
+
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+
+	return nil
+}
+
+// newEntry returns the entry for a response, or nil if it is not cached.
+func newEntry(k, options string, res *Result, now time.Time) *entry {
+	m := res.Msg
+
+	if len(m.Question) == 0 {
+		return nil
+	}
+
+	var ttl uint32
+
+	switch {
+	case m.Rcode == dns.RcodeSuccess && len(m.Answer) > 0:
+		ttl = minTTL(m.Answer)
+	case m.Rcode == dns.RcodeSuccess || m.Rcode == dns.RcodeNameError:
+		// The negative TTL is the smaller of the SOA TTL and minimum.
+		found := false
+
+		for _, rr := range m.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl = min(soa.Hdr.Ttl, soa.Minttl)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if ttl == 0 {
+		return nil
+	}
+
+	q := m.Question[0]
+
+	e := &entry{
+		Name:     dns.CanonicalName(q.Name),
+		Qtype:    dns.TypeToString[q.Qtype],
+		Options:  options,
+		Rcode:    m.Rcode,
+		AD:       m.AuthenticatedData,
+		Upstream: res.Upstream,
+		Stored:   now,
+		Expires:  now.Add(time.Duration(ttl) * time.Second),
+	}
+
+	if cacheKey(e.Name, e.Qtype, options) != k {
+		return nil
+	}
+
+	if res.Scope.IsValid() {
+		e.Scope = res.Scope.String()
+	}
+
+	for _, rr := range m.Answer {
+		e.Answer = append(e.Answer, rr.String())
+	}
+
+	for _, rr := range m.Ns {
+		e.Ns = append(e.Ns, rr.String())
+	}
+
+	return e
+}
+
+// minTTL returns the smallest TTL of rrs.
+func minTTL(rrs []dns.RR) uint32 {
+	ttl := rrs[0].Header().Ttl
+
+	for _, rr := range rrs[1:] {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+
+	return ttl
+}
+
+// result rebuilds the response from e, with the TTLs counting down from the
+// time it was stored.
+func (e *entry) result(name string, qtype uint16, now time.Time) (*Result, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.Response = true
+	m.RecursionAvailable = true
+	m.Rcode = e.Rcode
+	m.AuthenticatedData = e.AD
+
+	elapsed := uint32(max(now.Sub(e.Stored), 0) / time.Second)
+
+	var err error
+
+	if m.Answer, err = parseRRs(e.Answer, elapsed); err != nil {
+		return nil, fmt.Errorf("invalid cache entry for %s: %w", e.Name, err)
+	}
+
+	if m.Ns, err = parseRRs(e.Ns, elapsed); err != nil {
+		return nil, fmt.Errorf("invalid cache entry for %s: %w", e.Name, err)
+	}
+
+	res := &Result{
+		Msg:       m,
+		Upstream:  e.Upstream,
+		Transport: TransportCache,
+	}
+
+	if e.Scope != "" {
+		if res.Scope, err = netip.ParsePrefix(e.Scope); err != nil {
+			return nil, fmt.Errorf("invalid cache entry for %s: %w", e.Name, err)
+		}
+	}
+
+	return res, nil
+}
+
+// parseRRs parses the records of an entry with their TTLs reduced by elapsed
+// seconds.
+func parseRRs(strs []string, elapsed uint32) ([]dns.RR, error) {
+	var rrs []dns.RR
+
+	for _, s := range strs {
+		rr, err := dns.NewRR(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		h := rr.Header()
+		h.Ttl -= min(h.Ttl, elapsed)
+
+		rrs = append(rrs, rr)
+	}
+
+	return rrs, nil
+}
@@ -0,0 +1,351 @@
+package resolver_test
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// counter answers from a zone handler and counts the queries.
+type counter struct {
+	queries int
+	zh      dns.HandlerFunc
+}
+
+func (c *counter) Resolve(name string, qtype uint16) (*resolver.Result, error) {
+	c.queries++
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+
+	w := &recorder{}
+	c.zh(w, m)
+
+	return &resolver.Result{
+		Msg:       w.msg,
+		Upstream:  "192.0.2.53:53",
+		Transport: resolver.TransportUDP,
+	}, nil
+}
+
+// recorder is a dns.ResponseWriter keeping the response.
+type recorder struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *recorder) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := &counter{zh: zoneHandler(
+		"example. 3600 IN SOA ns.example. admin.example. 1 3600 600 86400 300",
+		"a.example. 60 IN A 192.0.2.1",
+		"b.example. 0 IN A 192.0.2.2",
+	)}
+
+	c := resolver.NewCache(r)
+	c.Now = func() time.Time { return now }
+
+	tests := []struct {
+		name      string
+		qname     string
+		after     time.Duration
+		rcode     int
+		transport string
+		queries   int
+	}{
+		{
+			name:      "miss",
+			qname:     "a.example",
+			rcode:     dns.RcodeSuccess,
+			transport: resolver.TransportUDP,
+			queries:   1,
+		},
+		{
+			name:      "hit",
+			qname:     "A.example.",
+			after:     30 * time.Second,
+			rcode:     dns.RcodeSuccess,
+			transport: resolver.TransportCache,
+			queries:   1,
+		},
+		{
+			name:      "expired",
+			qname:     "a.example",
+			after:     31 * time.Second,
+			rcode:     dns.RcodeSuccess,
+			transport: resolver.TransportUDP,
+			queries:   2,
+		},
+		{
+			name:      "negative miss",
+			qname:     "nx.example",
+			rcode:     dns.RcodeNameError,
+			transport: resolver.TransportUDP,
+			queries:   3,
+		},
+		{
+			name:      "negative hit",
+			qname:     "nx.example",
+			after:     299 * time.Second,
+			rcode:     dns.RcodeNameError,
+			transport: resolver.TransportCache,
+			queries:   3,
+		},
+		{
+			name:      "zero ttl",
+			qname:     "b.example",
+			rcode:     dns.RcodeSuccess,
+			transport: resolver.TransportUDP,
+			queries:   4,
+		},
+		{
+			name:      "zero ttl again",
+			qname:     "b.example",
+			rcode:     dns.RcodeSuccess,
+			transport: resolver.TransportUDP,
+			queries:   5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.after)
+
+			res, err := c.Resolve(tt.qname, dns.TypeA)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.rcode, res.Msg.Rcode)
+				assert.Equal(t, tt.transport, res.Transport)
+			}
+
+			assert.Equal(t, tt.queries, r.queries)
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c := resolver.NewCache(&counter{zh: zoneHandler(
+		"a.example. 60 IN A 192.0.2.1",
+	)})
+	c.Now = func() time.Time { return now }
+
+	_, err := c.Resolve("a.example", dns.TypeA)
+	assert.NoError(t, err)
+
+	now = now.Add(45 * time.Second)
+
+	res, err := c.Resolve("a.example", dns.TypeA)
+
+	if assert.NoError(t, err) && assert.Len(t, res.Msg.Answer, 1) {
+		assert.Equal(t, uint32(15), res.Msg.Answer[0].Header().Ttl)
+		assert.Equal(t, "192.0.2.1", res.Msg.Answer[0].(*dns.A).A.String())
+	}
+}
+
+func TestCacheSave(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cache.jsonl")
+
+	r := &counter{zh: zoneHandler(
+		"a.example. 60 IN A 192.0.2.1",
+		"c.example. 3600 IN A 192.0.2.3",
+	)}
+
+	c, err := resolver.LoadCache(r, path)
+	assert.NoError(t, err)
+	c.Now = func() time.Time { return now }
+
+	for _, name := range []string{"a.example", "c.example"} {
+		_, err = c.Resolve(name, dns.TypeA)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, c.Save(path))
+
+	t.Run("load", func(t *testing.T) {
+		r := &counter{zh: zoneHandler()}
+
+		c, err := resolver.LoadCache(r, path)
+		assert.NoError(t, err)
+		c.Now = func() time.Time { return now.Add(time.Minute) }
+
+		res, err := c.Resolve("c.example", dns.TypeA)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, resolver.TransportCache, res.Transport)
+			assert.Equal(t, "192.0.2.53:53", res.Upstream)
+		}
+
+		assert.Equal(t, 0, r.queries)
+		assert.Equal(t, 1, c.Hits)
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		r := &counter{zh: zoneHandler("c.example. 3600 IN A 192.0.2.3")}
+
+		c, err := resolver.LoadCache(r, path)
+		assert.NoError(t, err)
+		c.Now = func() time.Time { return now.Add(time.Minute) }
+		c.MaxAge = 30 * time.Second
+
+		_, err = c.Resolve("c.example", dns.TypeA)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, r.queries)
+	})
+
+	t.Run("only", func(t *testing.T) {
+		r := &counter{zh: zoneHandler()}
+
+		c, err := resolver.LoadCache(r, path)
+		assert.NoError(t, err)
+		c.Now = func() time.Time { return now.Add(2 * time.Minute) }
+		c.Only = true
+
+		// Expired entries still answer.
+		_, err = c.Resolve("a.example", dns.TypeA)
+		assert.NoError(t, err)
+
+		_, err = c.Resolve("b.example", dns.TypeA)
+		assert.ErrorIs(t, err, resolver.ErrCacheMiss)
+		assert.Equal(t, 0, r.queries)
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		r := &counter{zh: zoneHandler("c.example. 3600 IN A 192.0.2.4")}
+
+		c, err := resolver.LoadCache(r, path)
+		assert.NoError(t, err)
+		c.Now = func() time.Time { return now.Add(time.Minute) }
+		c.Refresh = true
+
+		res, err := c.Resolve("c.example", dns.TypeA)
+
+		if assert.NoError(t, err) && assert.Len(t, res.Msg.Answer, 1) {
+			assert.Equal(t, "192.0.2.4", res.Msg.Answer[0].(*dns.A).A.String())
+		}
+
+		assert.Equal(t, 1, r.queries)
+	})
+}
+
+// scope is the client subnet scope of the answers of scoped.
+var scope = netip.MustParsePrefix("198.51.100.0/24")
+
+// scoped is a counter answering with a client subnet scope.
+type scoped struct {
+	counter
+}
+
+func (s *scoped) Resolve(name string, qtype uint16) (*resolver.Result, error) {
+	res, err := s.counter.Resolve(name, qtype)
+
+	if err == nil {
+		res.Scope = scope
+	}
+
+	return res, err
+}
+
+func TestCacheOptions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cache.jsonl")
+
+	r := &scoped{counter: counter{zh: zoneHandler(
+		"a.example. 3600 IN A 192.0.2.1",
+	)}}
+
+	c, err := resolver.LoadCache(r, path)
+	assert.NoError(t, err)
+	c.Now = func() time.Time { return now }
+	c.Options = "dns=system ecs=198.51.100.0/24"
+
+	_, err = c.Resolve("a.example", dns.TypeA)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Save(path))
+
+	tests := []struct {
+		name    string
+		options string
+		queries int
+	}{
+		{name: "same", options: "dns=system ecs=198.51.100.0/24"},
+		{name: "other subnet", options: "dns=system ecs=203.0.113.0/24", queries: 1},
+		{name: "dnssec", options: "dns=system do cd", queries: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &counter{zh: zoneHandler("a.example. 3600 IN A 192.0.2.1")}
+
+			c, err := resolver.LoadCache(r, path)
+			assert.NoError(t, err)
+			c.Now = func() time.Time { return now.Add(time.Minute) }
+			c.Options = tt.options
+
+			res, err := c.Resolve("a.example", dns.TypeA)
+
+			if assert.NoError(t, err) && tt.queries == 0 {
+				assert.Equal(t, scope, res.Scope)
+			}
+
+			assert.Equal(t, tt.queries, r.queries)
+		})
+	}
+}
+
+func TestCacheSaveExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "cache.jsonl")
+
+	c, err := resolver.LoadCache(&counter{zh: zoneHandler(
+		"a.example. 60 IN A 192.0.2.1",
+		"b.example. 3600 IN A 192.0.2.2",
+		"c.example. 3600 IN A 192.0.2.3",
+	)}, path)
+	assert.NoError(t, err)
+	c.Now = func() time.Time { return now }
+
+	_, err = c.Resolve("a.example", dns.TypeA)
+	assert.NoError(t, err)
+
+	// The expired entry is kept when another one is added later.
+	now = now.Add(time.Hour)
+
+	_, err = c.Resolve("b.example", dns.TypeA)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Save(path))
+
+	load := func(maxAge time.Duration) error {
+		c, err := resolver.LoadCache(&counter{zh: zoneHandler()}, path)
+		assert.NoError(t, err)
+		c.Now = func() time.Time { return now }
+		c.Only = true
+		c.MaxAge = maxAge
+
+		_, err = c.Resolve("a.example", dns.TypeA)
+
+		return err
+	}
+
+	assert.NoError(t, load(0))
+
+	// Entries older than the maximum age are dropped.
+	c.MaxAge = 30 * time.Minute
+	_, err = c.Resolve("c.example", dns.TypeA)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Save(path))
+	assert.ErrorIs(t, load(0), resolver.ErrCacheMiss)
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+// cookieLen is the length of a client cookie in hex.
+const cookieLen = 16
+
+// CookieJar keeps the DNS cookies of RFC 7873 for each upstream. It is safe
+// for concurrent use and may be shared by the Clients of several upstreams.
+type CookieJar struct {
+	mu      sync.Mutex
+	cookies map[string]string
+}
+
+// NewCookieJar returns an empty CookieJar.
+func NewCookieJar() *CookieJar {
+	return &CookieJar{cookies: make(map[string]string)}
+}
+
+// Cookie returns the cookie to send to addr in hex. It is a random client
+// cookie, followed by the last server cookie returned by addr.
+func (j *CookieJar) Cookie(addr string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if c, ok := j.cookies[addr]; ok {
+		return c
+	}
+
+	b := make([]byte, cookieLen/2)
+	rand.Read(b)
+
+	c := hex.EncodeToString(b)
+	j.cookies[addr] = c
+
+	return c
+}
+
+// Update keeps the server cookie returned by addr. The cookie is ignored if
+// its client cookie is not the one sent to addr.
+func (j *CookieJar) Update(addr, cookie string) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	c, ok := j.cookies[addr]
+
+	if !ok ||
+		len(cookie) <= cookieLen ||
+		!strings.EqualFold(cookie[:cookieLen], c[:cookieLen]) {
+		return false
+	}
+
+	j.cookies[addr] = strings.ToLower(cookie)
+
+	return true
+}
@@ -0,0 +1,314 @@
+package resolver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// TransportImport is the transport of a Result imported from the output of
+// another resolver.
+const TransportImport = "import"
+
+// ErrNotImported is returned by an Imported for a query missing from the
+// imported output.
+var ErrNotImported = errors.New("query not imported")
+
+// importRR is a record in the JSON output of massdns or zdns. massdns gives
+// the data of the record in data, zdns in answer.
+type importRR struct {
+	Name   string `json:"name"`
+	TTL    uint32 `json:"ttl"`
+	Type   string `json:"type"`
+	Class  string `json:"class"`
+	Data   string `json:"data"`
+	Answer string `json:"answer"`
+}
+
+// importData is the response in the JSON output of massdns or zdns.
+type importData struct {
+	Answers     []importRR `json:"answers"`
+	Authorities []importRR `json:"authorities"`
+	Additionals []importRR `json:"additionals"`
+	Resolver    string     `json:"resolver"`
+	Protocol    string     `json:"protocol"`
+}
+
+// importLine is a line of the JSON output of massdns (-o J) or zdns. Newer
+// versions of zdns nest the results of each type under results.
+type importLine struct {
+	Name     string                `json:"name"`
+	Type     string                `json:"type"`
+	Status   string                `json:"status"`
+	Error    string                `json:"error"`
+	Resolver string                `json:"resolver"`
+	Data     *importData           `json:"data"`
+	Results  map[string]importLine `json:"results"`
+}
+
+// Imported is a Resolver answering from the output of a mass resolver such
+// as massdns or zdns, in their JSON lines or massdns simple (-o S) formats.
+type Imported struct {
+	// results has the responses of the JSON lines.
+	results map[string]*Result
+	// errs has the failed queries of the JSON lines.
+	errs map[string]error
+	// records has the records of the simple lines by owner name.
+	records map[string][]dns.RR
+}
+
+// NewImported returns an Imported without any result.
+func NewImported() *Imported {
+	return &Imported{
+		results: make(map[string]*Result),
+		errs:    make(map[string]error),
+		records: make(map[string][]dns.RR),
+	}
+}
+
+// LoadImport reads the outputs at paths.
+func LoadImport(paths []string) (*Imported, error) {
+	im := NewImported()
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = im.Read(f)
+		f.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return im, nil
+}
+
+// Read adds the results of an output. The format is detected on each line.
+func (im *Imported) Read(rd io.Reader) error {
+	scn := bufio.NewScanner(rd)
+	scn.Buffer(nil, dns.MaxMsgSize*4)
+
+	for n := 1; scn.Scan(); n++ {
+		line := strings.TrimSpace(scn.Text())
+
+		var err error
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "{"):
+			err = im.readJSON(line)
+		default:
+			err = im.readSimple(line)
+		}
+
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+
+	return scn.Err()
+}
+
+// readJSON adds a JSON line.
+func (im *Imported) readJSON(line string) error {
+	var l importLine
+
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return err
+	}
+
+	if l.Name == "" {
+		return errors.New("no name")
+	}
+
+	if len(l.Results) > 0 {
+		for qtype, r := range l.Results {
+			r.Name = l.Name
+			r.Type = qtype
+
+			if err := im.add(r); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return im.add(l)
+}
+
+// add adds the result of a JSON line. zdns leaves out the type of the query,
+// which is A unless the line has results by type.
+func (im *Imported) add(l importLine) error {
+	if l.Type == "" {
+		l.Type = dns.TypeToString[dns.TypeA]
+	}
+
+	qtype, ok := dns.StringToType[strings.ToUpper(l.Type)]
+
+	if !ok {
+		return fmt.Errorf("unknown type %q", l.Type)
+	}
+
+	k := key(l.Name, dns.TypeToString[qtype])
+
+	rcode, ok := dns.StringToRcode[strings.ToUpper(l.Status)]
+
+	if !ok || l.Error != "" || l.Data == nil {
+		// A timeout or another failure without a response.
+		msg := l.Error
+
+		if msg == "" {
+			msg = l.Status
+		}
+
+		im.errs[k] = fmt.Errorf("%s %s: %s", l.Name, l.Type, msg)
+
+		return nil
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(l.Name), qtype)
+	m.Response = true
+	m.Rcode = rcode
+	m.Answer = parseImported(l.Data.Answers)
+	m.Ns = parseImported(l.Data.Authorities)
+	m.Extra = parseImported(l.Data.Additionals)
+
+	upstream := l.Resolver
+
+	if upstream == "" {
+		upstream = l.Data.Resolver
+	}
+
+	im.results[k] = &Result{
+		Msg:       m,
+		Upstream:  upstream,
+		Transport: TransportImport,
+	}
+	delete(im.errs, k)
+
+	return nil
+}
+
+// parseImported returns the records of a JSON line. Records whose data is not
+// in presentation format, such as the structured SOA of zdns, are left out.
+func parseImported(rrs []importRR) []dns.RR {
+	var parsed []dns.RR
+
+	for _, r := range rrs {
+		data := r.Data
+
+		if data == "" {
+			data = r.Answer
+		}
+
+		class := r.Class
+
+		if class == "" {
+			class = "IN"
+		}
+
+		rr, err := dns.NewRR(fmt.Sprintf(
+			"%s %d %s %s %s",
+			dns.Fqdn(r.Name),
+			r.TTL,
+			class,
+			r.Type,
+			data,
+		))
+
+		if err == nil && rr != nil {
+			parsed = append(parsed, rr)
+		}
+	}
+
+	return parsed
+}
+
+// readSimple adds a line of the simple output of massdns, a record as the
+// owner name, the type and the data.
+func (im *Imported) readSimple(line string) error {
+	fields := strings.Fields(line)
+
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid record %q", line)
+	}
+
+	rr, err := dns.NewRR(fmt.Sprintf(
+		"%s 0 IN %s %s",
+		dns.Fqdn(fields[0]),
+		fields[1],
+		strings.Join(fields[2:], " "),
+	))
+
+	if err != nil {
+		return err
+	}
+
+	name := dns.CanonicalName(rr.Header().Name)
+	im.records[name] = append(im.records[name], rr)
+
+	return nil
+}
+
+// Resolve returns the imported result of the query. The records of the
+// simple output are answered following CNAMEs, and only if a record of the
+// type is found.
+func (im *Imported) Resolve(name string, qtype uint16) (*Result, error) {
+	k := key(name, dns.TypeToString[qtype])
+
+	if res, ok := im.results[k]; ok {
+		return res, nil
+	}
+
+	if err, ok := im.errs[k]; ok {
+		return nil, err
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.Response = true
+
+	cur := dns.CanonicalName(dns.Fqdn(name))
+	found := false
+
+	for depth := 0; depth <= maxCNAME; depth++ {
+		var cname *dns.CNAME
+
+		for _, rr := range im.records[cur] {
+			if rr.Header().Rrtype == qtype {
+				m.Answer = append(m.Answer, rr)
+				found = true
+			} else if c, ok := rr.(*dns.CNAME); ok {
+				cname = c
+			}
+		}
+
+		if found || cname == nil {
+			break
+		}
+
+		m.Answer = append(m.Answer, cname)
+		cur = dns.CanonicalName(cname.Target)
+	}
+
+	// The simple output has no negative answers.
+	if !found {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotImported, name, dns.TypeToString[qtype])
+	}
+
+	return &Result{Msg: m, Transport: TransportImport}, nil
+}
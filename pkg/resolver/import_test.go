@@ -0,0 +1,163 @@
+package resolver_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+const massdnsJSON = `{"name":"a.example.","type":"A","class":"IN","status":"NOERROR","rx_ts":1700000000000000000,"data":{"answers":[{"ttl":60,"type":"A","class":"IN","name":"a.example.","data":"192.0.2.1"}]},"flags":["rd","ra"],"resolver":"192.0.2.53:53"}
+{"name":"nx.example.","type":"A","class":"IN","status":"NXDOMAIN","data":{"authorities":[{"ttl":300,"type":"SOA","class":"IN","name":"example.","data":"ns.example. admin.example. 1 3600 600 86400 300"}]},"resolver":"192.0.2.53:53"}
+{"name":"slow.example.","type":"A","class":"IN","error":"timeout"}
+`
+
+const zdnsJSON = `{"name":"b.example","class":"IN","status":"NOERROR","timestamp":"2024-01-01T00:00:00Z","data":{"answers":[{"ttl":60,"type":"CNAME","class":"IN","name":"b.example","answer":"a.example."},{"ttl":60,"type":"A","class":"IN","name":"a.example","answer":"192.0.2.1"}],"authorities":[{"ttl":300,"type":"SOA","class":"IN","name":"example","ns":"ns.example","mbox":"admin.example"}],"protocol":"udp","resolver":"192.0.2.54:53"}}
+{"name":"c.example","results":{"AAAA":{"status":"NOERROR","data":{"answers":[{"ttl":60,"type":"AAAA","class":"IN","name":"c.example","answer":"2001:db8::1"}]}},"A":{"status":"SERVFAIL","data":{}}}}
+{"name":"d.example","class":"IN","status":"TIMEOUT","timestamp":"2024-01-01T00:00:00Z"}
+`
+
+const massdnsSimple = `www.e.example. CNAME e.example.
+e.example. A 192.0.2.5
+e.example. A 192.0.2.6
+`
+
+func TestImported(t *testing.T) {
+	im := resolver.NewImported()
+
+	for _, out := range []string{massdnsJSON, zdnsJSON, massdnsSimple} {
+		assert.NoError(t, im.Read(strings.NewReader(out)))
+	}
+
+	tests := []struct {
+		name     string
+		qname    string
+		qtype    uint16
+		rcode    int
+		answer   []string
+		upstream string
+		wantErr  error
+	}{
+		{
+			name:     "massdns",
+			qname:    "a.example",
+			qtype:    dns.TypeA,
+			rcode:    dns.RcodeSuccess,
+			answer:   []string{"192.0.2.1"},
+			upstream: "192.0.2.53:53",
+		},
+		{
+			name:     "massdns nxdomain",
+			qname:    "nx.example",
+			qtype:    dns.TypeA,
+			rcode:    dns.RcodeNameError,
+			upstream: "192.0.2.53:53",
+		},
+		{
+			name:     "zdns",
+			qname:    "B.example",
+			qtype:    dns.TypeA,
+			rcode:    dns.RcodeSuccess,
+			answer:   []string{"a.example.", "192.0.2.1"},
+			upstream: "192.0.2.54:53",
+		},
+		{
+			name:   "zdns results",
+			qname:  "c.example",
+			qtype:  dns.TypeAAAA,
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"2001:db8::1"},
+		},
+		{
+			name:  "zdns servfail",
+			qname: "c.example",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeServerFailure,
+		},
+		{
+			name:   "simple",
+			qname:  "www.e.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"e.example.", "192.0.2.5", "192.0.2.6"},
+		},
+		{
+			name:    "simple missing",
+			qname:   "www.e.example",
+			qtype:   dns.TypeAAAA,
+			wantErr: resolver.ErrNotImported,
+		},
+		{
+			name:    "missing",
+			qname:   "z.example",
+			qtype:   dns.TypeA,
+			wantErr: resolver.ErrNotImported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := im.Resolve(tt.qname, tt.qtype)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.rcode, res.Msg.Rcode)
+			assert.Equal(t, tt.upstream, res.Upstream)
+			assert.Equal(t, resolver.TransportImport, res.Transport)
+
+			var answer []string
+
+			for _, rr := range res.Msg.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					answer = append(answer, rr.A.String())
+				case *dns.AAAA:
+					answer = append(answer, rr.AAAA.String())
+				case *dns.CNAME:
+					answer = append(answer, rr.Target)
+				}
+			}
+
+			assert.Equal(t, tt.answer, answer)
+		})
+	}
+
+	for _, name := range []string{"slow.example", "d.example"} {
+		_, err := im.Resolve(name, dns.TypeA)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, resolver.ErrNotImported)
+	}
+}
+
+func TestLoadImport(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.ndjson")
+	bad := filepath.Join(dir, "bad.txt")
+
+	assert.NoError(t, os.WriteFile(good, []byte(massdnsJSON), 0o644))
+	assert.NoError(t, os.WriteFile(bad, []byte("a.example. A\n"), 0o644))
+
+	im, err := resolver.LoadImport([]string{good})
+
+	if assert.NoError(t, err) {
+		_, err = im.Resolve("a.example", dns.TypeA)
+		assert.NoError(t, err)
+	}
+
+	_, err = resolver.LoadImport([]string{good, bad})
+	assert.ErrorContains(t, err, "line 1")
+
+	_, err = resolver.LoadImport([]string{filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
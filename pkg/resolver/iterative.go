@@ -0,0 +1,398 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// RootHints are the addresses of the root servers, see
+// https://www.iana.org/domains/root/servers.
+var RootHints = []string{
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+	"2001:503:ba3e::2:30",
+	"2801:1b8:10::b",
+	"2001:500:2::c",
+	"2001:500:2d::d",
+	"2001:500:a8::e",
+	"2001:500:2f::f",
+	"2001:500:12::d0d",
+	"2001:500:1::53",
+	"2001:7fe::53",
+	"2001:503:c27::2:30",
+	"2001:7fd::1",
+	"2001:500:9f::42",
+	"2001:dc3::35",
+}
+
+// Limits of an iterative resolution.
+const (
+	// maxReferrals is the most referrals followed for a name.
+	maxReferrals = 16
+	// maxDepth is the most nested resolutions of CNAME targets and
+	// nameservers without glue.
+	maxDepth = 8
+)
+
+// ErrLoop is returned when an iterative resolution exceeds its limits.
+var ErrLoop = errors.New("resolution loop")
+
+// Iterative is a Resolver following referrals from the root servers without
+// any upstream. Delegations and answers are cached for the lifetime of the
+// Iterative.
+type Iterative struct {
+	// Hints are the addresses of the root servers.
+	Hints []string
+	// Port is the port of every nameserver.
+	Port string
+	// Client is the template of the queries to the nameservers.
+	Client Client
+	// Queries and Hits count the queries sent and the answers from the
+	// cache.
+	Queries, Hits int
+
+	mu          sync.Mutex
+	delegations map[string][]string
+	answers     map[string]*Result
+}
+
+// NewIterative returns an Iterative starting from RootHints and querying the
+// nameservers with a copy of c.
+func NewIterative(c Client) *Iterative {
+	return &Iterative{
+		Hints:       RootHints,
+		Port:        "53",
+		Client:      c,
+		delegations: make(map[string][]string),
+		answers:     make(map[string]*Result),
+	}
+}
+
+// Resolve resolves name iteratively.
+func (it *Iterative) Resolve(name string, qtype uint16) (*Result, error) {
+	return it.resolve(dns.CanonicalName(dns.Fqdn(name)), qtype, 0)
+}
+
+// resolve resolves name at a nesting depth.
+func (it *Iterative) resolve(name string, qtype uint16, depth int) (*Result, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: %s nested too deeply", ErrLoop, name)
+	}
+
+	key := name + "/" + dns.TypeToString[qtype]
+
+	it.mu.Lock()
+	res, ok := it.answers[key]
+
+	if ok {
+		it.Hits++
+	}
+
+	it.mu.Unlock()
+
+	if ok {
+		return res, nil
+	}
+
+	res, err := it.iterate(name, qtype, depth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res, err = it.restart(name, qtype, res, depth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	it.mu.Lock()
+	it.answers[key] = res
+	it.mu.Unlock()
+
+	return res, nil
+}
+
+// restart follows a CNAME in the answer to name unless the nameserver
+// already did so.
+func (it *Iterative) restart(
+	name string,
+	qtype uint16,
+	res *Result,
+	depth int,
+) (*Result, error) {
+	if qtype == dns.TypeCNAME {
+		return res, nil
+	}
+
+	target := ""
+
+	for _, rr := range res.Msg.Answer {
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			if strings.EqualFold(rr.Hdr.Name, name) {
+				target = dns.CanonicalName(rr.Target)
+			}
+		default:
+			if rr.Header().Rrtype == qtype {
+				return res, nil
+			}
+		}
+	}
+
+	if target == "" {
+		return res, nil
+	}
+
+	for _, rr := range res.Msg.Answer {
+		if strings.EqualFold(rr.Header().Name, target) {
+			return res, nil
+		}
+	}
+
+	next, err := it.resolve(target, qtype, depth+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m := res.Msg.Copy()
+	m.Answer = append(m.Answer, next.Msg.Answer...)
+	m.Rcode = next.Msg.Rcode
+
+	return &Result{
+		Msg:       m,
+		Upstream:  next.Upstream,
+		Transport: next.Transport,
+		RTT:       res.RTT + next.RTT,
+	}, nil
+}
+
+// closest returns the closest cached delegation of name.
+func (it *Iterative) closest(name string) (string, []string) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	for cur := name; ; {
+		if servers, ok := it.delegations[cur]; ok {
+			return cur, servers
+		}
+
+		if cur == "." {
+			break
+		}
+
+		if off, end := dns.NextLabel(cur, 0); end {
+			cur = "."
+		} else {
+			cur = cur[off:]
+		}
+	}
+
+	servers := make([]string, len(it.Hints))
+
+	for i, h := range it.Hints {
+		servers[i] = net.JoinHostPort(h, it.Port)
+	}
+
+	return ".", servers
+}
+
+// addr returns the address of a nameserver at ip.
+func (it *Iterative) addr(ip net.IP) string {
+	return net.JoinHostPort(ip.String(), it.Port)
+}
+
+// iterate follows the referrals for name from its closest delegation.
+func (it *Iterative) iterate(name string, qtype uint16, depth int) (*Result, error) {
+	zone, servers := it.closest(name)
+
+	for i := 0; i < maxReferrals; i++ {
+		res, err := it.query(servers, name, qtype)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m := res.Msg
+
+		if m.Authoritative ||
+			len(m.Answer) > 0 ||
+			m.Rcode != dns.RcodeSuccess {
+			return res, nil
+		}
+
+		child, hosts := referral(m, zone, name)
+
+		if child == "" {
+			return nil, fmt.Errorf(
+				"lame response from %s for %s",
+				res.Upstream,
+				name,
+			)
+		}
+
+		servers, err = it.addresses(zone, child, hosts, m.Extra, depth)
+
+		if err != nil {
+			return nil, err
+		}
+
+		it.mu.Lock()
+		it.delegations[child] = servers
+		it.mu.Unlock()
+
+		zone = child
+	}
+
+	return nil, fmt.Errorf("%w: too many referrals for %s", ErrLoop, name)
+}
+
+// query sends a non-recursive query to the servers until one responds.
+func (it *Iterative) query(servers []string, name string, qtype uint16) (*Result, error) {
+	var errs []error
+
+	for _, addr := range servers {
+		c := it.Client
+		c.Addr = addr
+		c.NoRecursion = true
+
+		it.mu.Lock()
+		it.Queries++
+		it.mu.Unlock()
+
+		res, err := c.Resolve(name, qtype)
+
+		if err == nil &&
+			res.Msg.Rcode != dns.RcodeServerFailure &&
+			res.Msg.Rcode != dns.RcodeRefused {
+			return res, nil
+		}
+
+		if err == nil {
+			err = fmt.Errorf(
+				"%s from %s",
+				dns.RcodeToString[res.Msg.Rcode],
+				addr,
+			)
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// referral returns the child zone delegated to in m and its nameservers.
+// The child must be below zone, which stops a referral loop, and be an
+// ancestor of name.
+func referral(m *dns.Msg, zone, name string) (string, []string) {
+	child := ""
+	var hosts []string
+
+	for _, rr := range m.Ns {
+		ns, ok := rr.(*dns.NS)
+
+		if !ok {
+			continue
+		}
+
+		owner := dns.CanonicalName(ns.Hdr.Name)
+
+		if owner == zone ||
+			!dns.IsSubDomain(zone, owner) ||
+			!dns.IsSubDomain(owner, name) {
+			continue
+		}
+
+		if child == "" {
+			child = owner
+		}
+
+		if owner == child {
+			hosts = append(hosts, dns.CanonicalName(ns.Ns))
+		}
+	}
+
+	return child, hosts
+}
+
+// addresses returns the addresses of the nameservers of zone. Glue is used
+// if it is within the bailiwick of the delegating zone, other nameservers are
+// resolved.
+func (it *Iterative) addresses(
+	bailiwick, zone string,
+	hosts []string,
+	extra []dns.RR,
+	depth int,
+) ([]string, error) {
+	var servers, glueless []string
+
+	for _, host := range hosts {
+		found := false
+
+		for _, rr := range extra {
+			if !strings.EqualFold(rr.Header().Name, host) ||
+				!dns.IsSubDomain(bailiwick, host) {
+				continue
+			}
+
+			switch rr := rr.(type) {
+			case *dns.A:
+				servers = append(servers, it.addr(rr.A))
+				found = true
+			case *dns.AAAA:
+				servers = append(servers, it.addr(rr.AAAA))
+				found = true
+			}
+		}
+
+		if !found {
+			glueless = append(glueless, host)
+		}
+	}
+
+	if len(servers) > 0 {
+		return servers, nil
+	}
+
+	for _, host := range glueless {
+		res, err := it.resolve(host, dns.TypeA, depth+1)
+
+		if err != nil {
+			if errors.Is(err, ErrLoop) {
+				return nil, err
+			}
+
+			continue
+		}
+
+		for _, rr := range res.Msg.Answer {
+			if a, ok := rr.(*dns.A); ok {
+				servers = append(servers, it.addr(a.A))
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no address for the nameservers of %s", zone)
+	}
+
+	return servers, nil
+}
@@ -0,0 +1,229 @@
+package resolver_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// delegator answers authoritatively for the zones from records, and with a
+// referral for the names delegated to a child zone by an NS record.
+func delegator(zones []string, records ...string) dns.HandlerFunc {
+	rrs := make(map[string][]dns.RR)
+
+	for _, s := range records {
+		rr, _ := dns.NewRR(s)
+		name := dns.CanonicalName(rr.Header().Name)
+		rrs[name] = append(rrs[name], rr)
+	}
+
+	isZone := make(map[string]bool)
+
+	for _, z := range zones {
+		isZone[z] = true
+	}
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		q := r.Question[0]
+		name := dns.CanonicalName(q.Name)
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		// Walk up from the name to its zone looking for a delegation.
+		for cur := name; !isZone[cur]; {
+			for _, rr := range rrs[cur] {
+				if ns, ok := rr.(*dns.NS); ok {
+					m.Ns = append(m.Ns, ns)
+					m.Extra = append(m.Extra, rrs[ns.Ns]...)
+				}
+			}
+
+			if len(m.Ns) > 0 {
+				w.WriteMsg(m)
+				return
+			}
+
+			off, end := dns.NextLabel(cur, 0)
+
+			if end {
+				break
+			}
+
+			cur = cur[off:]
+		}
+
+		m.Authoritative = true
+
+		for _, rr := range rrs[name] {
+			t := rr.Header().Rrtype
+
+			if t == q.Qtype || t == dns.TypeCNAME {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+
+		if _, ok := rrs[name]; !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+
+		w.WriteMsg(m)
+	}
+}
+
+// hierarchy starts a root, a TLD and an authoritative server on different
+// loopback addresses sharing a port, and returns the port.
+func hierarchy(t *testing.T) string {
+	t.Helper()
+
+	if pc, err := net.ListenPacket("udp", "127.0.0.2:0"); err != nil {
+		t.Skipf("loopback addresses other than 127.0.0.1 unavailable: %v", err)
+	} else {
+		pc.Close()
+	}
+
+	root := serveAt(t, "127.0.0.1:0", delegator(
+		[]string{"."},
+		"test. 3600 IN NS ns.test.",
+		"ns.test. 3600 IN A 127.0.0.2",
+		"loop. 3600 IN NS ns.loop.",
+		"ns.loop. 3600 IN A 127.0.0.4",
+	))
+
+	_, port, _ := net.SplitHostPort(root)
+
+	serveAt(t, net.JoinHostPort("127.0.0.2", port), delegator(
+		[]string{"test."},
+		"example.test. 3600 IN NS ns.example.test.",
+		"ns.example.test. 3600 IN A 127.0.0.3",
+		"glueless.test. 3600 IN NS ns2.example.test.",
+	))
+
+	serveAt(t, net.JoinHostPort("127.0.0.3", port), delegator(
+		[]string{"example.test.", "glueless.test."},
+		"ns2.example.test. 3600 IN A 127.0.0.3",
+		"www.example.test. 60 IN A 192.0.2.1",
+		"alias.example.test. 60 IN CNAME www.example.test.",
+		"loop1.example.test. 60 IN CNAME loop2.example.test.",
+		"loop2.example.test. 60 IN CNAME loop1.example.test.",
+		"www.glueless.test. 60 IN A 192.0.2.2",
+	))
+
+	// The server for loop. refers back to the root.
+	serveAt(t, net.JoinHostPort("127.0.0.4", port), func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		rr, _ := dns.NewRR(". 3600 IN NS ns.test.")
+		m.Ns = append(m.Ns, rr)
+
+		w.WriteMsg(m)
+	})
+
+	return port
+}
+
+func TestIterative(t *testing.T) {
+	port := hierarchy(t)
+
+	it := resolver.NewIterative(resolver.Client{Timeout: time.Second})
+	it.Hints = []string{"127.0.0.1"}
+	it.Port = port
+
+	tests := []struct {
+		name   string
+		qname  string
+		rcode  int
+		answer []string
+	}{
+		{
+			name:   "glue",
+			qname:  "www.example.test",
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"192.0.2.1"},
+		},
+		{
+			name:   "cname",
+			qname:  "alias.example.test",
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"www.example.test.", "192.0.2.1"},
+		},
+		{
+			name:   "glueless",
+			qname:  "www.glueless.test",
+			rcode:  dns.RcodeSuccess,
+			answer: []string{"192.0.2.2"},
+		},
+		{
+			name:   "nxdomain",
+			qname:  "nx.example.test",
+			rcode:  dns.RcodeNameError,
+			answer: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := it.Resolve(tt.qname, dns.TypeA)
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.rcode, res.Msg.Rcode)
+
+			var answer []string
+
+			for _, rr := range res.Msg.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					answer = append(answer, rr.A.String())
+				case *dns.CNAME:
+					answer = append(answer, rr.Target)
+				}
+			}
+
+			assert.Equal(t, tt.answer, answer)
+		})
+	}
+}
+
+func TestIterativeCache(t *testing.T) {
+	port := hierarchy(t)
+
+	it := resolver.NewIterative(resolver.Client{Timeout: time.Second})
+	it.Hints = []string{"127.0.0.1"}
+	it.Port = port
+
+	_, err := it.Resolve("www.example.test", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, it.Queries)
+
+	// The delegation of example.test. is cached.
+	_, err = it.Resolve("nx.example.test", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, it.Queries)
+
+	_, err = it.Resolve("www.example.test", dns.TypeA)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, it.Queries)
+	assert.Equal(t, 1, it.Hits)
+}
+
+func TestIterativeLoop(t *testing.T) {
+	port := hierarchy(t)
+
+	it := resolver.NewIterative(resolver.Client{Timeout: time.Second})
+	it.Hints = []string{"127.0.0.1"}
+	it.Port = port
+
+	_, err := it.Resolve("loop1.example.test", dns.TypeA)
+	assert.ErrorIs(t, err, resolver.ErrLoop)
+
+	_, err = it.Resolve("www.loop", dns.TypeA)
+	assert.Error(t, err)
+}
@@ -0,0 +1,274 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Policies for querying multiple upstreams.
+const (
+	// PolicyFailover queries the upstreams in order, moving to the next one
+	// on an error or SERVFAIL.
+	PolicyFailover = "failover"
+	// PolicyRoundRobin is PolicyFailover starting at a different upstream
+	// for each query.
+	PolicyRoundRobin = "round-robin"
+	// PolicyConsensus queries every upstream and returns data only if a
+	// quorum of them returned data, see Multi.Data.
+	PolicyConsensus = "consensus"
+)
+
+// ErrNoUpstream is returned when a Multi has no upstream.
+var ErrNoUpstream = errors.New("no upstream")
+
+// Stats counts the queries sent to an upstream.
+type Stats struct {
+	Queries  int
+	Errors   int
+	ServFail int
+	RTT      time.Duration
+}
+
+// String summarizes the statistics.
+func (s Stats) String() string {
+	var avg time.Duration
+
+	if n := s.Queries - s.Errors; n > 0 {
+		avg = s.RTT / time.Duration(n)
+	}
+
+	return fmt.Sprintf(
+		"%d queries, %d errors, %d SERVFAIL, %v average RTT",
+		s.Queries,
+		s.Errors,
+		s.ServFail,
+		avg,
+	)
+}
+
+// Upstream is a named Resolver with its statistics.
+type Upstream struct {
+	Name     string
+	Resolver Resolver
+	Stats    Stats
+}
+
+// Multi is a Resolver querying several upstreams according to a policy.
+type Multi struct {
+	Upstreams []*Upstream
+	Policy    string
+	// Quorum is the number of upstreams that must return data under
+	// PolicyConsensus. A majority is required if Quorum is zero.
+	Quorum int
+	// Attempts is the number of times PolicyFailover and PolicyRoundRobin
+	// go through the upstreams. They go through once if Attempts is zero.
+	Attempts int
+	// Data reports whether a response returned data under PolicyConsensus,
+	// so that a filtering upstream answering with a sinkhole address does
+	// not vote. A response with answers returned data if Data is nil.
+	Data func(m *dns.Msg) bool
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewMulti returns a Multi querying the upstream addresses with a copy of
+// the Client c each.
+func NewMulti(
+	addrs []string,
+	policy string,
+	quorum int,
+	c Client,
+) (*Multi, error) {
+	switch policy {
+	case PolicyFailover, PolicyRoundRobin, PolicyConsensus:
+	default:
+		return nil, fmt.Errorf("unknown policy %q", policy)
+	}
+
+	if quorum < 0 || quorum > len(addrs) {
+		return nil, fmt.Errorf(
+			"quorum %d out of range for %d upstreams",
+			quorum,
+			len(addrs),
+		)
+	}
+
+	m := &Multi{Policy: policy, Quorum: quorum}
+
+	for _, addr := range addrs {
+		u := c
+		u.Addr = addr
+
+		m.Upstreams = append(m.Upstreams, &Upstream{
+			Name:     addr,
+			Resolver: &u,
+		})
+	}
+
+	return m, nil
+}
+
+// ParseUpstreams splits a comma separated list of upstreams. The port is
+// added to an upstream without one.
+func ParseUpstreams(list, port string) []string {
+	var addrs []string
+
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+
+		if s == "" {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(strings.Trim(s, "[]"), port)
+		}
+
+		addrs = append(addrs, s)
+	}
+
+	return addrs
+}
+
+// Resolve queries the upstreams for name according to the policy.
+func (m *Multi) Resolve(name string, qtype uint16) (*Result, error) {
+	if len(m.Upstreams) == 0 {
+		return nil, ErrNoUpstream
+	}
+
+	switch m.Policy {
+	case PolicyRoundRobin:
+		m.mu.Lock()
+		start := m.next
+		m.next = (m.next + 1) % len(m.Upstreams)
+		m.mu.Unlock()
+
+		return m.failover(start, name, qtype)
+	case PolicyConsensus:
+		return m.consensus(name, qtype)
+	default:
+		return m.failover(0, name, qtype)
+	}
+}
+
+// query sends a query to u and records it in the statistics.
+func (m *Multi) query(u *Upstream, name string, qtype uint16) (*Result, error) {
+	res, err := u.Resolver.Resolve(name, qtype)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u.Stats.Queries++
+
+	switch {
+	case err != nil:
+		u.Stats.Errors++
+	case res.Msg.Rcode == dns.RcodeServerFailure:
+		u.Stats.ServFail++
+		u.Stats.RTT += res.RTT
+	default:
+		u.Stats.RTT += res.RTT
+	}
+
+	return res, err
+}
+
+// failover queries the upstreams in order from start until one neither
+// fails nor returns SERVFAIL.
+func (m *Multi) failover(start int, name string, qtype uint16) (*Result, error) {
+	var res *Result
+	var err error
+
+	n := len(m.Upstreams) * max(m.Attempts, 1)
+
+	for i := 0; i < n; i++ {
+		u := m.Upstreams[(start+i)%len(m.Upstreams)]
+
+		res, err = m.query(u, name, qtype)
+
+		if err == nil && res.Msg.Rcode != dns.RcodeServerFailure {
+			break
+		}
+	}
+
+	return res, err
+}
+
+// data reports whether m returned data.
+func (m *Multi) data(msg *dns.Msg) bool {
+	if m.Data != nil {
+		return m.Data(msg)
+	}
+
+	return msg.Rcode == dns.RcodeSuccess && len(msg.Answer) > 0
+}
+
+// consensus queries every upstream and returns a response with data only if
+// a quorum of upstreams returned data.
+func (m *Multi) consensus(name string, qtype uint16) (*Result, error) {
+	quorum := m.Quorum
+
+	if quorum == 0 {
+		quorum = len(m.Upstreams)/2 + 1
+	}
+
+	results := make([]*Result, len(m.Upstreams))
+	errs := make([]error, len(m.Upstreams))
+
+	var wg sync.WaitGroup
+
+	for i, u := range m.Upstreams {
+		wg.Add(1)
+
+		go func(i int, u *Upstream) {
+			defer wg.Done()
+			results[i], errs[i] = m.query(u, name, qtype)
+		}(i, u)
+	}
+
+	wg.Wait()
+
+	var data, other *Result
+	votes := 0
+
+	for _, res := range results {
+		switch {
+		case res == nil:
+		case m.data(res.Msg):
+			votes++
+
+			if data == nil {
+				data = res
+			}
+		case other == nil:
+			other = res
+		}
+	}
+
+	if votes >= quorum {
+		return data, nil
+	}
+
+	if other != nil {
+		return other, nil
+	}
+
+	if data != nil {
+		// Too few upstreams answered to reach the quorum.
+		return nil, fmt.Errorf(
+			"%d of %d upstreams returned data, %d required",
+			votes,
+			len(m.Upstreams),
+			quorum,
+		)
+	}
+
+	return nil, errors.Join(errs...)
+}
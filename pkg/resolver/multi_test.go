@@ -0,0 +1,265 @@
+package resolver_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// client is the template of the upstreams in the tests.
+var client = resolver.Client{Timeout: time.Second}
+
+// handleRcode answers with rcode and, on success, one A record.
+func handleRcode(rcode int) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+
+		if rcode == dns.RcodeSuccess {
+			rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 192.0.2.1")
+			m.Answer = append(m.Answer, rr)
+		}
+
+		w.WriteMsg(m)
+	}
+}
+
+func TestParseUpstreams(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want []string
+	}{
+		{
+			name: "single",
+			list: "8.8.8.8",
+			want: []string{"8.8.8.8:53"},
+		},
+		{
+			name: "multiple",
+			list: "8.8.8.8, 1.1.1.1:5353",
+			want: []string{"8.8.8.8:53", "1.1.1.1:5353"},
+		},
+		{
+			name: "IPv6",
+			list: "2001:db8::53,[2001:db8::54],[2001:db8::55]:5353",
+			want: []string{
+				"[2001:db8::53]:53",
+				"[2001:db8::54]:53",
+				"[2001:db8::55]:5353",
+			},
+		},
+		{
+			name: "empty",
+			list: "",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, resolver.ParseUpstreams(tt.list, "53"))
+		})
+	}
+}
+
+func TestNewMulti(t *testing.T) {
+	_, err := resolver.NewMulti(
+		[]string{"192.0.2.1:53"}, "random", 0, client,
+	)
+	assert.Error(t, err)
+
+	_, err = resolver.NewMulti(
+		[]string{"192.0.2.1:53"}, resolver.PolicyConsensus, 2, client,
+	)
+	assert.Error(t, err)
+}
+
+func TestMultiFailover(t *testing.T) {
+	addrs := []string{
+		serve(t, handleRcode(dns.RcodeServerFailure)),
+		serve(t, handleRcode(dns.RcodeSuccess)),
+	}
+
+	m, err := resolver.NewMulti(
+		addrs, resolver.PolicyFailover, 0, client,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		res, err := m.Resolve("example.com", dns.TypeA)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, addrs[1], res.Upstream)
+		}
+	}
+
+	assert.Equal(t, 2, m.Upstreams[0].Stats.Queries)
+	assert.Equal(t, 2, m.Upstreams[0].Stats.ServFail)
+	assert.Equal(t, 2, m.Upstreams[1].Stats.Queries)
+}
+
+func TestMultiAttempts(t *testing.T) {
+	addrs := []string{serve(t, handleRcode(dns.RcodeServerFailure))}
+
+	m, err := resolver.NewMulti(
+		addrs, resolver.PolicyFailover, 0, client,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	m.Attempts = 3
+
+	res, err := m.Resolve("example.com", dns.TypeA)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dns.RcodeServerFailure, res.Msg.Rcode)
+	}
+
+	assert.Equal(t, 3, m.Upstreams[0].Stats.Queries)
+}
+
+func TestMultiRoundRobin(t *testing.T) {
+	addrs := []string{
+		serve(t, handleRcode(dns.RcodeSuccess)),
+		serve(t, handleRcode(dns.RcodeSuccess)),
+	}
+
+	m, err := resolver.NewMulti(
+		addrs, resolver.PolicyRoundRobin, 0, client,
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := 0; i < 4; i++ {
+		res, err := m.Resolve("example.com", dns.TypeA)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, addrs[i%2], res.Upstream)
+		}
+	}
+
+	assert.Equal(t, 2, m.Upstreams[0].Stats.Queries)
+	assert.Equal(t, 2, m.Upstreams[1].Stats.Queries)
+}
+
+func TestMultiConsensus(t *testing.T) {
+	ok := serve(t, handleRcode(dns.RcodeSuccess))
+	nx := serve(t, handleRcode(dns.RcodeNameError))
+
+	tests := []struct {
+		name   string
+		addrs  []string
+		quorum int
+		rcode  int
+	}{
+		{
+			name:   "majority",
+			addrs:  []string{ok, ok, nx},
+			quorum: 0,
+			rcode:  dns.RcodeSuccess,
+		},
+		{
+			name:   "minority",
+			addrs:  []string{ok, nx, nx},
+			quorum: 0,
+			rcode:  dns.RcodeNameError,
+		},
+		{
+			name:   "quorum",
+			addrs:  []string{ok, nx, nx},
+			quorum: 1,
+			rcode:  dns.RcodeSuccess,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := resolver.NewMulti(
+				tt.addrs, resolver.PolicyConsensus, tt.quorum, client,
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			res, err := m.Resolve("example.com", dns.TypeA)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.rcode, res.Msg.Rcode)
+			}
+
+			for _, u := range m.Upstreams {
+				assert.Equal(t, 1, u.Stats.Queries)
+			}
+		})
+	}
+}
+
+func TestMultiConsensusData(t *testing.T) {
+	ok := serve(t, handleRcode(dns.RcodeSuccess))
+	sink := serve(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		rr, _ := dns.NewRR(r.Question[0].Name + " 60 IN A 0.0.0.0")
+		m.Answer = append(m.Answer, rr)
+
+		w.WriteMsg(m)
+	})
+
+	// data is true for the answers other than the sinkhole address.
+	data := func(m *dns.Msg) bool {
+		for _, rr := range m.Answer {
+			if a, ok := rr.(*dns.A); ok && !a.A.IsUnspecified() {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	tests := []struct {
+		name  string
+		addrs []string
+		want  string
+	}{
+		{
+			name:  "majority",
+			addrs: []string{sink, ok, ok},
+			want:  "192.0.2.1",
+		},
+		{
+			name:  "minority",
+			addrs: []string{ok, sink, sink},
+			want:  "0.0.0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := resolver.NewMulti(
+				tt.addrs, resolver.PolicyConsensus, 0, client,
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			m.Data = data
+
+			res, err := m.Resolve("example.com", dns.TypeA)
+
+			if assert.NoError(t, err) && assert.Len(t, res.Msg.Answer, 1) {
+				assert.Equal(
+					t,
+					tt.want,
+					res.Msg.Answer[0].(*dns.A).A.String(),
+				)
+			}
+		})
+	}
+}
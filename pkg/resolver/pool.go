@@ -0,0 +1,304 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultTimeout is the timeout of a pooled query without one, the default
+// of dns.Client.
+const defaultTimeout = 2 * time.Second
+
+// errClosed is returned for the queries pending on a connection when it is
+// closed.
+var errClosed = errors.New("connection closed")
+
+// Pool shares connections to the upstreams between queries and goroutines.
+// Queries on a connection are told apart by their ID, so a UDP socket is
+// reused and TCP queries are pipelined without waiting for the previous
+// response.
+type Pool struct {
+	// Dials and Reuses count the connections opened and the queries sent on
+	// an open connection.
+	Dials, Reuses int
+
+	mu    sync.Mutex
+	conns map[string]*muxConn
+}
+
+// NewPool returns an empty Pool.
+func NewPool() *Pool {
+	return &Pool{conns: make(map[string]*muxConn)}
+}
+
+// Exchange sends m to addr over network from the local address src, if it is
+// valid, and waits for the response. A query failing on a reused connection
+// closed by the upstream is sent again on a new connection.
+func (p *Pool) Exchange(
+	network, addr string,
+	src netip.Addr,
+	m *dns.Msg,
+	timeout time.Duration,
+) (*dns.Msg, time.Duration, error) {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	for retried := false; ; retried = true {
+		mc, reused, err := p.get(network, addr, src, timeout)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		in, rtt, err := mc.exchange(m, timeout)
+
+		if reused && !retried && errors.Is(err, errClosed) {
+			continue
+		}
+
+		return in, rtt, err
+	}
+}
+
+// Close closes every connection of the Pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, mc := range p.conns {
+		mc.close(net.ErrClosed)
+		delete(p.conns, key)
+	}
+}
+
+// get returns an open connection to addr from src, and whether it was
+// reused.
+func (p *Pool) get(
+	network, addr string,
+	src netip.Addr,
+	timeout time.Duration,
+) (*muxConn, bool, error) {
+	key := network + "/" + src.String() + "/" + addr
+
+	p.mu.Lock()
+	mc, ok := p.conns[key]
+
+	if ok && mc.alive() {
+		p.Reuses++
+		p.mu.Unlock()
+
+		return mc, true, nil
+	}
+
+	p.mu.Unlock()
+
+	conn, err := dialer(network, src, timeout).Dial(network, addr)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Another goroutine may have dialed in the meantime.
+	if mc, ok := p.conns[key]; ok && mc.alive() {
+		conn.Close()
+		p.Reuses++
+
+		return mc, true, nil
+	}
+
+	mc = &muxConn{
+		addr:    addr,
+		conn:    &dns.Conn{Conn: conn},
+		pending: make(map[uint16]*pending),
+		done:    make(chan struct{}),
+	}
+
+	go mc.read()
+
+	p.conns[key] = mc
+	p.Dials++
+
+	return mc, false, nil
+}
+
+// pending is a query waiting for its response.
+type pending struct {
+	q  dns.Question
+	ch chan *dns.Msg
+}
+
+// muxConn is a connection shared by concurrent queries.
+type muxConn struct {
+	addr string
+	conn *dns.Conn
+	// wmu serializes the writes.
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint16]*pending
+	// err is set and done is closed when the connection is closed.
+	err  error
+	done chan struct{}
+}
+
+// alive reports whether the connection is open.
+func (mc *muxConn) alive() bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	return mc.err == nil
+}
+
+// close closes the connection, failing the pending queries with err.
+func (mc *muxConn) close(err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.err != nil {
+		return
+	}
+
+	mc.err = fmt.Errorf("%w: %s: %v", errClosed, mc.addr, err)
+	close(mc.done)
+	mc.conn.Close()
+}
+
+// exchange sends m under an ID unused on the connection and waits for the
+// response.
+func (mc *muxConn) exchange(m *dns.Msg, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	p := &pending{ch: make(chan *dns.Msg, 1)}
+
+	if len(m.Question) > 0 {
+		p.q = m.Question[0]
+	}
+
+	mc.mu.Lock()
+
+	if mc.err != nil {
+		err := mc.err
+		mc.mu.Unlock()
+
+		return nil, 0, err
+	}
+
+	id := m.Id
+
+	for mc.pending[id] != nil {
+		id = dns.Id()
+	}
+
+	mc.pending[id] = p
+	mc.mu.Unlock()
+
+	defer func() {
+		mc.mu.Lock()
+
+		if mc.pending[id] == p {
+			delete(mc.pending, id)
+		}
+
+		mc.mu.Unlock()
+	}()
+
+	q := m
+
+	if id != m.Id {
+		q = m.Copy()
+		q.Id = id
+	}
+
+	start := time.Now()
+
+	mc.wmu.Lock()
+	mc.conn.SetWriteDeadline(start.Add(timeout))
+	err := mc.conn.WriteMsg(q)
+	mc.wmu.Unlock()
+
+	if err != nil {
+		mc.close(err)
+
+		return nil, 0, fmt.Errorf("%w: %s: %v", errClosed, mc.addr, err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case in := <-p.ch:
+		in.Id = m.Id
+
+		return in, time.Since(start), nil
+	case <-mc.done:
+		return nil, 0, mc.err
+	case <-timer.C:
+		return nil, 0, fmt.Errorf(
+			"%w: no response from %s",
+			os.ErrDeadlineExceeded,
+			mc.addr,
+		)
+	}
+}
+
+// read delivers the responses to the pending queries until the connection
+// fails. Responses not matching a pending query are dropped.
+func (mc *muxConn) read() {
+	buf := make([]byte, dns.MaxMsgSize)
+
+	for {
+		n, err := mc.conn.Read(buf)
+
+		if err != nil {
+			mc.close(err)
+			return
+		}
+
+		in := new(dns.Msg)
+
+		if err := in.Unpack(append([]byte(nil), buf[:n]...)); err != nil {
+			continue
+		}
+
+		mc.mu.Lock()
+		p := mc.pending[in.Id]
+
+		if p != nil && matches(in, p.q) {
+			delete(mc.pending, in.Id)
+		} else {
+			p = nil
+		}
+
+		mc.mu.Unlock()
+
+		if p != nil {
+			p.ch <- in
+		}
+	}
+}
+
+// matches reports whether in is a response to the question q.
+func matches(in *dns.Msg, q dns.Question) bool {
+	if !in.Response {
+		return false
+	}
+
+	if len(in.Question) == 0 {
+		// Some errors are returned without the question.
+		return in.Rcode != dns.RcodeSuccess
+	}
+
+	return in.Question[0].Qtype == q.Qtype &&
+		in.Question[0].Qclass == q.Qclass &&
+		strings.EqualFold(in.Question[0].Name, q.Name)
+}
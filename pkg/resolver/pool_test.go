@@ -0,0 +1,137 @@
+package resolver_test
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+func TestPool(t *testing.T) {
+	addr := serve(t, handleRcode(dns.RcodeSuccess))
+
+	pool := resolver.NewPool()
+	defer pool.Close()
+
+	c := resolver.NewClient(addr, time.Second, 0)
+	c.Pool = pool
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(name string) {
+			defer wg.Done()
+
+			res, err := c.Resolve(name, dns.TypeA)
+
+			if assert.NoError(t, err) && assert.Len(t, res.Msg.Answer, 1) {
+				assert.Equal(t, name, res.Msg.Answer[0].Header().Name)
+				assert.Equal(t, resolver.TransportUDP, res.Transport)
+			}
+		}(fmt.Sprintf("%d.example.", i))
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 1, pool.Dials)
+	assert.Equal(t, 49, pool.Reuses)
+}
+
+func TestPoolID(t *testing.T) {
+	addr := serve(t, handleRcode(dns.RcodeSuccess))
+
+	pool := resolver.NewPool()
+	defer pool.Close()
+
+	var wg sync.WaitGroup
+
+	// Concurrent queries with the same ID are told apart.
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func(name string) {
+			defer wg.Done()
+
+			m := new(dns.Msg)
+			m.SetQuestion(name, dns.TypeA)
+			m.Id = 1
+
+			in, _, err := pool.Exchange(resolver.TransportUDP, addr, netip.Addr{}, m, time.Second)
+
+			if assert.NoError(t, err) && assert.Len(t, in.Answer, 1) {
+				assert.Equal(t, uint16(1), in.Id)
+				assert.Equal(t, name, in.Answer[0].Header().Name)
+			}
+		}(fmt.Sprintf("%d.example.", i))
+	}
+
+	wg.Wait()
+}
+
+func TestPoolTCP(t *testing.T) {
+	addr := serve(t, handleBig(100))
+
+	pool := resolver.NewPool()
+	defer pool.Close()
+
+	c := resolver.NewClient(addr, time.Second, 0)
+	c.Pool = pool
+
+	for i := 0; i < 3; i++ {
+		res, err := c.Resolve("big.example", dns.TypeA)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, resolver.TransportTCP, res.Transport)
+			assert.Len(t, res.Msg.Answer, 100)
+		}
+	}
+
+	// One UDP and one TCP connection.
+	assert.Equal(t, 2, pool.Dials)
+	assert.Equal(t, 4, pool.Reuses)
+}
+
+func TestPoolTimeout(t *testing.T) {
+	addr := serve(t, func(w dns.ResponseWriter, r *dns.Msg) {})
+
+	pool := resolver.NewPool()
+	defer pool.Close()
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.", dns.TypeA)
+
+	_, _, err := pool.Exchange(resolver.TransportUDP, addr, netip.Addr{}, m, 50*time.Millisecond)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func BenchmarkClient(b *testing.B) {
+	addr := serve(b, handleRcode(dns.RcodeSuccess))
+
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pool=%t", pooled), func(b *testing.B) {
+			c := resolver.NewClient(addr, time.Second, 0)
+
+			if pooled {
+				c.Pool = resolver.NewPool()
+				defer c.Pool.Close()
+			}
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := c.Resolve("example.", dns.TypeA); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package resolver
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNotRecorded is returned by a Replay for a query missing from the
+// capture.
+var ErrNotRecorded = errors.New("query not recorded")
+
+// exchange is a query and its outcome, stored as one JSON line.
+type exchange struct {
+	Name      string        `json:"name"`
+	Qtype     string        `json:"qtype"`
+	Upstream  string        `json:"upstream,omitempty"`
+	Transport string        `json:"transport,omitempty"`
+	RTT       time.Duration `json:"rtt,omitempty"`
+	// Msg is the response in wire format.
+	Msg   []byte `json:"msg,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Probe is the upstream the query was sent to apart from the others.
+	Probe string `json:"probe,omitempty"`
+}
+
+// Recorder is a Resolver writing every query to another Resolver and its
+// response or error to a capture.
+type Recorder struct {
+	Resolver Resolver
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder returns a Recorder in front of r writing the capture to w.
+func NewRecorder(r Resolver, w io.Writer) *Recorder {
+	return &Recorder{Resolver: r, enc: json.NewEncoder(w)}
+}
+
+// Resolve queries the Resolver and records the outcome.
+func (rec *Recorder) Resolve(name string, qtype uint16) (*Result, error) {
+	return rec.record(rec.Resolver, "", name, qtype)
+}
+
+// Probe returns a Resolver querying the upstream u and recording the outcomes
+// apart from the other queries, such as those of the canary.
+func (rec *Recorder) Probe(u *Upstream) Resolver {
+	return &probe{rec: rec, upstream: u}
+}
+
+// record queries r and records the outcome as a probe of upstream unless it
+// is empty.
+func (rec *Recorder) record(
+	r Resolver,
+	upstream, name string,
+	qtype uint16,
+) (*Result, error) {
+	res, err := r.Resolve(name, qtype)
+
+	x := exchange{
+		Name:  dns.CanonicalName(dns.Fqdn(name)),
+		Qtype: dns.TypeToString[qtype],
+		Probe: upstream,
+	}
+
+	if err != nil {
+		x.Error = err.Error()
+	} else {
+		x.Upstream = res.Upstream
+		x.Transport = res.Transport
+		x.RTT = res.RTT
+
+		if x.Msg, err = res.Msg.Pack(); err != nil {
+			return nil, fmt.Errorf("failed to record %s: %w", name, err)
+		}
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if err := rec.enc.Encode(&x); err != nil {
+		return nil, fmt.Errorf("failed to record %s: %w", name, err)
+	}
+
+	return res, err
+}
+
+// probe is a Resolver recording the queries to an upstream as probes.
+type probe struct {
+	rec      *Recorder
+	upstream *Upstream
+}
+
+func (p *probe) Resolve(name string, qtype uint16) (*Result, error) {
+	return p.rec.record(p.upstream.Resolver, p.upstream.Name, name, qtype)
+}
+
+// Replay is a Resolver answering from a capture written by a Recorder. A
+// query recorded several times is answered with the outcomes in order, the
+// last one repeating.
+type Replay struct {
+	mu        sync.Mutex
+	exchanges map[string][]*exchange
+	// probed are the upstreams probed in the capture in order.
+	probed []string
+}
+
+// NewReplay reads a capture from rd.
+func NewReplay(rd io.Reader) (*Replay, error) {
+	rp := &Replay{exchanges: make(map[string][]*exchange)}
+
+	scn := bufio.NewScanner(rd)
+	scn.Buffer(nil, dns.MaxMsgSize*2)
+
+	for n := 1; scn.Scan(); n++ {
+		x := new(exchange)
+
+		if err := json.Unmarshal(scn.Bytes(), x); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		k := x.Probe + " " + key(x.Name, x.Qtype)
+
+		if x.Probe != "" && !slices.Contains(rp.probed, x.Probe) {
+			rp.probed = append(rp.probed, x.Probe)
+		}
+
+		rp.exchanges[k] = append(rp.exchanges[k], x)
+	}
+
+	if err := scn.Err(); err != nil {
+		return nil, err
+	}
+
+	return rp, nil
+}
+
+// Resolve returns the next recorded outcome of the query.
+func (rp *Replay) Resolve(name string, qtype uint16) (*Result, error) {
+	return rp.resolve("", name, qtype)
+}
+
+// Upstreams returns the upstreams probed in the capture, each answering from
+// its probes.
+func (rp *Replay) Upstreams() []*Upstream {
+	us := make([]*Upstream, len(rp.probed))
+
+	for i, name := range rp.probed {
+		us[i] = &Upstream{Name: name, Resolver: &replayProbe{rp, name}}
+	}
+
+	return us
+}
+
+// replayProbe is a Resolver answering from the probes of an upstream.
+type replayProbe struct {
+	rp       *Replay
+	upstream string
+}
+
+func (p *replayProbe) Resolve(name string, qtype uint16) (*Result, error) {
+	return p.rp.resolve(p.upstream, name, qtype)
+}
+
+// resolve returns the next recorded outcome of the query, probing upstream
+// unless it is empty.
+func (rp *Replay) resolve(
+	upstream, name string,
+	qtype uint16,
+) (*Result, error) {
+	k := upstream + " " + key(name, dns.TypeToString[qtype])
+
+	rp.mu.Lock()
+	xs := rp.exchanges[k]
+
+	if len(xs) > 1 {
+		rp.exchanges[k] = xs[1:]
+	}
+
+	rp.mu.Unlock()
+
+	if len(xs) == 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNotRecorded, name, dns.TypeToString[qtype])
+	}
+
+	x := xs[0]
+
+	if x.Error != "" {
+		return nil, errors.New(x.Error)
+	}
+
+	m := new(dns.Msg)
+
+	if err := m.Unpack(x.Msg); err != nil {
+		return nil, fmt.Errorf("invalid recorded response for %s: %w", name, err)
+	}
+
+	return &Result{
+		Msg:       m,
+		Upstream:  x.Upstream,
+		Transport: x.Transport,
+		RTT:       x.RTT,
+		Scope:     scopeOf(m),
+	}, nil
+}
@@ -0,0 +1,181 @@
+package resolver_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// failing fails every query for a name in its set.
+type failing struct {
+	resolver.Resolver
+	names map[string]bool
+}
+
+func (f *failing) Resolve(name string, qtype uint16) (*resolver.Result, error) {
+	if f.names[name] {
+		return nil, errors.New("i/o timeout")
+	}
+
+	return f.Resolver.Resolve(name, qtype)
+}
+
+func TestRecordReplay(t *testing.T) {
+	r := &failing{
+		Resolver: &counter{zh: zoneHandler(
+			"example. 3600 IN SOA ns.example. admin.example. 1 3600 600 86400 300",
+			"a.example. 60 IN A 192.0.2.1",
+		)},
+		names: map[string]bool{"slow.example": true},
+	}
+
+	var capture bytes.Buffer
+
+	rec := resolver.NewRecorder(r, &capture)
+
+	for _, name := range []string{"a.example", "nx.example", "slow.example"} {
+		rec.Resolve(name, dns.TypeA)
+	}
+
+	rp, err := resolver.NewReplay(&capture)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name    string
+		qname   string
+		qtype   uint16
+		rcode   int
+		answer  int
+		errMsg  string
+		wantErr error
+	}{
+		{
+			name:   "answer",
+			qname:  "a.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			answer: 1,
+		},
+		{
+			name:   "nxdomain",
+			qname:  "NX.example.",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeNameError,
+			answer: 0,
+		},
+		{
+			name:   "error",
+			qname:  "slow.example",
+			qtype:  dns.TypeA,
+			errMsg: "i/o timeout",
+		},
+		{
+			name:    "not recorded",
+			qname:   "a.example",
+			qtype:   dns.TypeAAAA,
+			wantErr: resolver.ErrNotRecorded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := rp.Resolve(tt.qname, tt.qtype)
+
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.rcode, res.Msg.Rcode)
+				assert.Len(t, res.Msg.Answer, tt.answer)
+				assert.Equal(t, "192.0.2.53:53", res.Upstream)
+				assert.Equal(t, resolver.TransportUDP, res.Transport)
+			}
+		})
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	var capture bytes.Buffer
+
+	for _, rr := range []string{
+		"a.example. 60 IN A 192.0.2.1",
+		"a.example. 60 IN A 192.0.2.2",
+	} {
+		rec := resolver.NewRecorder(&counter{zh: zoneHandler(rr)}, &capture)
+		rec.Resolve("a.example", dns.TypeA)
+	}
+
+	rp, err := resolver.NewReplay(&capture)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, want := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.2"} {
+		res, err := rp.Resolve("a.example", dns.TypeA)
+
+		if assert.NoError(t, err) && assert.Len(t, res.Msg.Answer, 1) {
+			assert.Equal(t, want, res.Msg.Answer[0].(*dns.A).A.String())
+		}
+	}
+}
+
+func TestRecordReplayProbe(t *testing.T) {
+	soa := "example. 3600 IN SOA ns.example. admin.example. 1 3600 600 86400 300"
+	r := &counter{zh: zoneHandler(soa, "a.example. 60 IN A 192.0.2.1")}
+	u := &resolver.Upstream{
+		Name:     "192.0.2.53:53",
+		Resolver: &counter{zh: zoneHandler(soa)},
+	}
+
+	var capture bytes.Buffer
+
+	rec := resolver.NewRecorder(r, &capture)
+
+	_, err := rec.Probe(u).Resolve("a.example", dns.TypeA)
+	assert.NoError(t, err)
+
+	_, err = rec.Resolve("a.example", dns.TypeA)
+	assert.NoError(t, err)
+
+	rp, err := resolver.NewReplay(&capture)
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The probe does not answer the other queries.
+	res, err := rp.Resolve("a.example", dns.TypeA)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dns.RcodeSuccess, res.Msg.Rcode)
+	}
+
+	us := rp.Upstreams()
+
+	if !assert.Len(t, us, 1) {
+		return
+	}
+
+	assert.Equal(t, u.Name, us[0].Name)
+
+	res, err = us[0].Resolver.Resolve("a.example", dns.TypeA)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dns.RcodeNameError, res.Msg.Rcode)
+	}
+}
@@ -0,0 +1,239 @@
+// Package resolver sends the queries of the leaky prefix checker.
+package resolver
+
+import (
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Transports recorded in a Result.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+)
+
+// DefaultBufSize is the EDNS0 UDP payload size advertised by default. It is
+// the value recommended by the DNS Flag Day 2020 to avoid IP fragmentation.
+const DefaultBufSize = 1232
+
+// Result is the response to a single query.
+type Result struct {
+	Msg       *dns.Msg
+	Upstream  string
+	Transport string
+	RTT       time.Duration
+	// Scope is the client subnet the response is valid for, as returned in
+	// the EDNS0 Client Subnet option. It is invalid if none was returned.
+	Scope netip.Prefix
+}
+
+// Resolver answers a query for a name.
+type Resolver interface {
+	Resolve(name string, qtype uint16) (*Result, error)
+}
+
+// Client is a Resolver querying a single upstream. Responses truncated over
+// UDP are retried over TCP.
+type Client struct {
+	Addr    string
+	Timeout time.Duration
+	// BufSize is the advertised EDNS0 UDP payload size. EDNS0 is not used
+	// if BufSize is zero, unless an option requiring it is set.
+	BufSize uint16
+	// DNSSEC sets the DO and AD bits to request DNSSEC records and the
+	// validation status of the upstream.
+	DNSSEC bool
+	// CheckingDisabled sets the CD bit to disable validation on the
+	// upstream.
+	CheckingDisabled bool
+	// Subnet is sent in the EDNS0 Client Subnet option of RFC 7871 if it is
+	// valid.
+	Subnet netip.Prefix
+	// Cookies sends DNS cookies if it is not nil.
+	Cookies *CookieJar
+	// NoRecursion clears the RD bit to query an authoritative server.
+	NoRecursion bool
+	// Pool shares the connections to the upstream if it is not nil,
+	// otherwise a connection is dialed for each query.
+	Pool *Pool
+	// Sources are the local addresses the queries are sent from. The first
+	// one in the family of the upstream is used, and the system chooses if
+	// there is none.
+	Sources []netip.Addr
+}
+
+// NewClient returns a Client querying addr.
+func NewClient(addr string, timeout time.Duration, bufSize uint16) *Client {
+	return &Client{
+		Addr:    addr,
+		Timeout: timeout,
+		BufSize: bufSize,
+	}
+}
+
+// Resolve queries the upstream for name.
+func (c *Client) Resolve(name string, qtype uint16) (*Result, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = !c.NoRecursion
+
+	edns := c.DNSSEC || c.Subnet.IsValid() || c.Cookies != nil
+
+	switch {
+	case edns && c.BufSize == 0:
+		m.SetEdns0(DefaultBufSize, c.DNSSEC)
+	case edns || c.BufSize > 0:
+		m.SetEdns0(c.BufSize, c.DNSSEC)
+	}
+
+	if c.DNSSEC {
+		m.AuthenticatedData = true
+		m.CheckingDisabled = c.CheckingDisabled
+	}
+
+	opt := m.IsEdns0()
+
+	if c.Subnet.IsValid() {
+		ecs := &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: uint8(c.Subnet.Bits()),
+			Address:       c.Subnet.Masked().Addr().AsSlice(),
+		}
+
+		if c.Subnet.Addr().Is6() {
+			ecs.Family = 2
+		}
+
+		opt.Option = append(opt.Option, ecs)
+	}
+
+	var cookie *dns.EDNS0_COOKIE
+
+	if c.Cookies != nil {
+		cookie = &dns.EDNS0_COOKIE{
+			Code:   dns.EDNS0COOKIE,
+			Cookie: c.Cookies.Cookie(c.Addr),
+		}
+
+		opt.Option = append(opt.Option, cookie)
+	}
+
+	res, err := c.Exchange(m)
+
+	if err != nil || c.Cookies == nil {
+		return res, err
+	}
+
+	fresh := false
+
+	if rc := cookieOf(res.Msg); rc != nil {
+		fresh = c.Cookies.Update(c.Addr, rc.Cookie)
+	}
+
+	// Retry once with the new server cookie, see RFC 7873 section 5.3.
+	if res.Msg.Rcode == dns.RcodeBadCookie && fresh {
+		cookie.Cookie = c.Cookies.Cookie(c.Addr)
+		m.Id = dns.Id()
+
+		return c.Exchange(m)
+	}
+
+	return res, nil
+}
+
+// cookieOf returns the cookie option of m.
+func cookieOf(m *dns.Msg) *dns.EDNS0_COOKIE {
+	if opt := m.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if cookie, ok := o.(*dns.EDNS0_COOKIE); ok {
+				return cookie
+			}
+		}
+	}
+
+	return nil
+}
+
+// scopeOf returns the scope of the client subnet option of m.
+func scopeOf(m *dns.Msg) netip.Prefix {
+	if opt := m.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+				addr, ok := netip.AddrFromSlice(ecs.Address)
+
+				if !ok {
+					return netip.Prefix{}
+				}
+
+				if ecs.Family == 1 {
+					addr = addr.Unmap()
+				}
+
+				pfx, _ := addr.Prefix(int(ecs.SourceScope))
+
+				return pfx
+			}
+		}
+	}
+
+	return netip.Prefix{}
+}
+
+// Exchange sends m to the upstream over UDP, and again over TCP if the
+// response is truncated.
+func (c *Client) Exchange(m *dns.Msg) (*Result, error) {
+	in, rtt, err := c.exchange(TransportUDP, m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !in.Truncated {
+		return &Result{
+			Msg:       in,
+			Upstream:  c.Addr,
+			Transport: TransportUDP,
+			RTT:       rtt,
+			Scope:     scopeOf(in),
+		}, nil
+	}
+
+	in, rtt, err = c.exchange(TransportTCP, m)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Msg:       in,
+		Upstream:  c.Addr,
+		Transport: TransportTCP,
+		RTT:       rtt,
+		Scope:     scopeOf(in),
+	}, nil
+}
+
+// exchange sends m to the upstream over network, on the Pool if there is
+// one.
+func (c *Client) exchange(network string, m *dns.Msg) (*dns.Msg, time.Duration, error) {
+	src := source(c.Sources, c.Addr)
+
+	if c.Pool != nil {
+		return c.Pool.Exchange(network, c.Addr, src, m, c.Timeout)
+	}
+
+	dc := &dns.Client{
+		Net:     network,
+		Timeout: c.Timeout,
+		Dialer:  dialer(network, src, c.Timeout),
+	}
+
+	if network == TransportUDP {
+		dc.UDPSize = c.BufSize
+	}
+
+	return dc.Exchange(m, c.Addr)
+}
@@ -0,0 +1,257 @@
+package resolver_test
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+// serve starts a UDP and a TCP server sharing one port on the loopback.
+func serve(t testing.TB, h dns.HandlerFunc) string {
+	t.Helper()
+
+	return serveAt(t, "127.0.0.1:0", h)
+}
+
+// serveAt starts a UDP and a TCP server sharing one address.
+func serveAt(t testing.TB, addr string, h dns.HandlerFunc) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	for _, s := range []*dns.Server{
+		{PacketConn: pc, Handler: h},
+		{Listener: l, Handler: h},
+	} {
+		started := make(chan struct{})
+		s.NotifyStartedFunc = func() { close(started) }
+
+		go s.ActivateAndServe()
+		<-started
+
+		t.Cleanup(func() { s.Shutdown() })
+	}
+
+	return pc.LocalAddr().String()
+}
+
+// handleBig answers with n A records, truncated to the advertised size over
+// UDP.
+func handleBig(n int) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+
+		for i := 0; i < n; i++ {
+			rr, _ := dns.NewRR(fmt.Sprintf(
+				"%s 60 IN A 192.0.2.%d", r.Question[0].Name, i,
+			))
+			m.Answer = append(m.Answer, rr)
+		}
+
+		if w.LocalAddr().Network() == "udp" {
+			size := dns.MinMsgSize
+
+			if opt := r.IsEdns0(); opt != nil {
+				size = int(opt.UDPSize())
+			}
+
+			m.Truncate(size)
+		}
+
+		w.WriteMsg(m)
+	}
+}
+
+func TestClientResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		records   int
+		bufSize   uint16
+		transport string
+	}{
+		{
+			name:      "small",
+			records:   1,
+			bufSize:   resolver.DefaultBufSize,
+			transport: resolver.TransportUDP,
+		},
+		{
+			name:      "fitsEDNS0",
+			records:   40,
+			bufSize:   resolver.DefaultBufSize,
+			transport: resolver.TransportUDP,
+		},
+		{
+			name:      "truncatedNoEDNS0",
+			records:   40,
+			bufSize:   0,
+			transport: resolver.TransportTCP,
+		},
+		{
+			name:      "truncatedEDNS0",
+			records:   100,
+			bufSize:   resolver.DefaultBufSize,
+			transport: resolver.TransportTCP,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serve(t, handleBig(tt.records))
+			c := resolver.NewClient(addr, time.Second, tt.bufSize)
+
+			res, err := c.Resolve("example.com", dns.TypeA)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.transport, res.Transport)
+				assert.False(t, res.Msg.Truncated)
+				assert.Len(t, res.Msg.Answer, tt.records)
+			}
+		})
+	}
+}
+
+func TestClientResolveEDNS0(t *testing.T) {
+	size := make(chan uint16, 1)
+
+	addr := serve(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if opt := r.IsEdns0(); opt != nil {
+			size <- opt.UDPSize()
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	c := resolver.NewClient(addr, time.Second, 4096)
+
+	if _, err := c.Resolve("example.com", dns.TypeA); assert.NoError(t, err) {
+		assert.Equal(t, uint16(4096), <-size)
+	}
+}
+
+func TestClientResolveSubnet(t *testing.T) {
+	tests := []struct {
+		name   string
+		subnet string
+		family uint16
+		scope  string
+	}{
+		{
+			name:   "IPv4",
+			subnet: "198.51.100.17/24",
+			family: 1,
+			scope:  "198.51.0.0/16",
+		},
+		{
+			name:   "IPv6",
+			subnet: "2001:db8:1:2::/56",
+			family: 2,
+			scope:  "2001:db8:1::/48",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(chan *dns.EDNS0_SUBNET, 1)
+
+			addr := serve(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				m := new(dns.Msg)
+				m.SetReply(r)
+				m.SetEdns0(resolver.DefaultBufSize, false)
+
+				for _, o := range r.IsEdns0().Option {
+					if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+						got <- ecs
+
+						scope := *ecs
+						scope.SourceScope = ecs.SourceNetmask - 8
+						m.IsEdns0().Option = append(m.IsEdns0().Option, &scope)
+					}
+				}
+
+				w.WriteMsg(m)
+			})
+
+			c := resolver.NewClient(addr, time.Second, 0)
+			c.Subnet = netip.MustParsePrefix(tt.subnet)
+
+			res, err := c.Resolve("example.com", dns.TypeA)
+
+			if assert.NoError(t, err) {
+				ecs := <-got
+				assert.Equal(t, tt.family, ecs.Family)
+				assert.Equal(t, uint8(c.Subnet.Bits()), ecs.SourceNetmask)
+				assert.Equal(t, netip.MustParsePrefix(tt.scope), res.Scope)
+			}
+		})
+	}
+}
+
+func TestClientResolveCookie(t *testing.T) {
+	const server = "0123456789abcdef"
+
+	// The server requires its cookie like a server under attack would.
+	addr := serve(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.SetEdns0(resolver.DefaultBufSize, false)
+
+		for _, o := range r.IsEdns0().Option {
+			if cookie, ok := o.(*dns.EDNS0_COOKIE); ok {
+				if cookie.Cookie[16:] != server {
+					m.Rcode = dns.RcodeBadCookie
+				}
+
+				m.IsEdns0().Option = append(
+					m.IsEdns0().Option,
+					&dns.EDNS0_COOKIE{
+						Code:   dns.EDNS0COOKIE,
+						Cookie: cookie.Cookie[:16] + server,
+					},
+				)
+			}
+		}
+
+		w.WriteMsg(m)
+	})
+
+	c := resolver.NewClient(addr, time.Second, 0)
+	c.Cookies = resolver.NewCookieJar()
+
+	res, err := c.Resolve("example.com", dns.TypeA)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, dns.RcodeSuccess, res.Msg.Rcode)
+		assert.Equal(t, server, c.Cookies.Cookie(addr)[16:])
+	}
+}
+
+func TestCookieJar(t *testing.T) {
+	j := resolver.NewCookieJar()
+
+	c := j.Cookie("192.0.2.1:53")
+	assert.Len(t, c, 16)
+	assert.Equal(t, c, j.Cookie("192.0.2.1:53"))
+	assert.NotEqual(t, c, j.Cookie("192.0.2.2:53"))
+
+	assert.False(t, j.Update("192.0.2.1:53", "ffffffffffffffff0123456789abcdef"))
+	assert.False(t, j.Update("192.0.2.3:53", c+"0123456789abcdef"))
+	assert.True(t, j.Update("192.0.2.1:53", c+"0123456789ABCDEF"))
+	assert.Equal(t, c+"0123456789abcdef", j.Cookie("192.0.2.1:53"))
+}
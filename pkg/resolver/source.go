@@ -0,0 +1,114 @@
+package resolver
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// ParseSources parses comma separated local addresses.
+func ParseSources(list string) ([]netip.Addr, error) {
+	var sources []netip.Addr
+
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(s)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, addr.Unmap())
+	}
+
+	return sources, nil
+}
+
+// InterfaceAddrs returns the global unicast addresses of the network
+// interface name. Link-local addresses are left out as they need a zone to
+// reach the upstream.
+func InterfaceAddrs(name string) ([]netip.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := iface.Addrs()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []netip.Addr
+
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+
+		if !ok {
+			continue
+		}
+
+		addr, ok := netip.AddrFromSlice(ipnet.IP)
+
+		if !ok {
+			continue
+		}
+
+		addr = addr.Unmap()
+
+		if addr.IsGlobalUnicast() || addr.IsLoopback() {
+			sources = append(sources, addr)
+		}
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no usable address on interface %s", name)
+	}
+
+	return sources, nil
+}
+
+// source returns the first of sources in the family of the upstream addr, or
+// an invalid address to let the system choose.
+func source(sources []netip.Addr, addr string) netip.Addr {
+	ap, err := netip.ParseAddrPort(addr)
+
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	is4 := ap.Addr().Unmap().Is4()
+
+	for _, s := range sources {
+		if s.Is4() == is4 {
+			return s
+		}
+	}
+
+	return netip.Addr{}
+}
+
+// dialer returns a dialer for network from the local address src if it is
+// valid.
+func dialer(network string, src netip.Addr, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout}
+
+	if !src.IsValid() {
+		return d
+	}
+
+	switch network {
+	case TransportUDP:
+		d.LocalAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(src, 0))
+	case TransportTCP:
+		d.LocalAddr = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, 0))
+	}
+
+	return d
+}
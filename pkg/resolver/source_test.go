@@ -0,0 +1,112 @@
+package resolver_test
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+func TestParseSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		sources []netip.Addr
+		wantErr bool
+	}{
+		{
+			name:    "empty",
+			list:    "",
+			sources: nil,
+		},
+		{
+			name: "both families",
+			list: "192.0.2.1, 2001:db8::1",
+			sources: []netip.Addr{
+				netip.MustParseAddr("192.0.2.1"),
+				netip.MustParseAddr("2001:db8::1"),
+			},
+		},
+		{
+			name:    "mapped",
+			list:    "::ffff:192.0.2.1",
+			sources: []netip.Addr{netip.MustParseAddr("192.0.2.1")},
+		},
+		{
+			name:    "invalid",
+			list:    "192.0.2.1,eth0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := resolver.ParseSources(tt.list)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.sources, sources)
+		})
+	}
+}
+
+func TestClientSources(t *testing.T) {
+	if pc, err := net.ListenPacket("udp", "127.0.0.2:0"); err != nil {
+		t.Skipf("loopback addresses other than 127.0.0.1 unavailable: %v", err)
+	} else {
+		pc.Close()
+	}
+
+	remote := make(chan string, 1)
+
+	addr := serve(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		ap, _ := netip.ParseAddrPort(w.RemoteAddr().String())
+		remote <- ap.Addr().String()
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	for _, pooled := range []bool{false, true} {
+		c := resolver.NewClient(addr, time.Second, 0)
+		c.Sources = []netip.Addr{
+			netip.MustParseAddr("::1"),
+			netip.MustParseAddr("127.0.0.2"),
+		}
+
+		if pooled {
+			c.Pool = resolver.NewPool()
+			defer c.Pool.Close()
+		}
+
+		_, err := c.Resolve("example.", dns.TypeA)
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "127.0.0.2", <-remote)
+		}
+	}
+}
+
+func TestInterfaceAddrs(t *testing.T) {
+	if _, err := net.InterfaceByName("lo"); err != nil {
+		t.Skipf("no loopback interface named lo: %v", err)
+	}
+
+	sources, err := resolver.InterfaceAddrs("lo")
+
+	if assert.NoError(t, err) {
+		assert.Contains(t, sources, netip.MustParseAddr("127.0.0.1"))
+	}
+
+	_, err = resolver.InterfaceAddrs("nonexistent0")
+	assert.Error(t, err)
+}
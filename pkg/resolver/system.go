@@ -0,0 +1,74 @@
+package resolver
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DefaultResolvConf is the path to the resolver configuration of the system.
+const DefaultResolvConf = "/etc/resolv.conf"
+
+// System is the resolver configuration of the system. Search domains and
+// ndots are not kept as every query is fully qualified.
+type System struct {
+	Upstreams []string
+	Timeout   time.Duration
+	Attempts  int
+	Rotate    bool
+}
+
+// LoadSystem reads a resolv.conf(5) file. Like the C library, the resolver on
+// the local host is used if the file lists no nameserver.
+func LoadSystem(path string) (*System, error) {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := dns.ClientConfigFromReader(bytes.NewReader(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sys := &System{
+		Timeout:  time.Duration(cfg.Timeout) * time.Second,
+		Attempts: cfg.Attempts,
+	}
+
+	servers := cfg.Servers
+
+	if len(servers) == 0 {
+		servers = []string{"127.0.0.1"}
+	}
+
+	for _, s := range servers {
+		sys.Upstreams = append(sys.Upstreams, net.JoinHostPort(s, cfg.Port))
+	}
+
+	// The rotate option is not kept by dns.ClientConfig.
+	scn := bufio.NewScanner(bytes.NewReader(b))
+
+	for scn.Scan() {
+		f := strings.Fields(scn.Text())
+
+		if len(f) == 0 || f[0] != "options" {
+			continue
+		}
+
+		for _, opt := range f[1:] {
+			if opt == "rotate" {
+				sys.Rotate = true
+			}
+		}
+	}
+
+	return sys, scn.Err()
+}
@@ -0,0 +1,72 @@
+package resolver_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+func TestLoadSystem(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+		want *resolver.System
+	}{
+		{
+			name: "default",
+			conf: "nameserver 192.0.2.53\n",
+			want: &resolver.System{
+				Upstreams: []string{"192.0.2.53:53"},
+				Timeout:   5 * time.Second,
+				Attempts:  2,
+			},
+		},
+		{
+			name: "options",
+			conf: "search example.com\n" +
+				"nameserver 192.0.2.53\n" +
+				"nameserver 2001:db8::53\n" +
+				"options ndots:2 timeout:3 attempts:4 rotate\n",
+			want: &resolver.System{
+				Upstreams: []string{"192.0.2.53:53", "[2001:db8::53]:53"},
+				Timeout:   3 * time.Second,
+				Attempts:  4,
+				Rotate:    true,
+			},
+		},
+		{
+			name: "noNameserver",
+			conf: "search example.com\n",
+			want: &resolver.System{
+				Upstreams: []string{"127.0.0.1:53"},
+				Timeout:   5 * time.Second,
+				Attempts:  2,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "resolv.conf")
+
+			if err := os.WriteFile(path, []byte(tt.conf), 0o644); err != nil {
+				t.Fatalf("failed to write %q: %v", path, err)
+			}
+
+			got, err := resolver.LoadSystem(path)
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoadSystemMissing(t *testing.T) {
+	_, err := resolver.LoadSystem(filepath.Join(t.TempDir(), "resolv.conf"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,287 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// TransportZone is the transport of a Result answered from zone files.
+const TransportZone = "zone"
+
+// Zones is a Resolver answering authoritatively from RFC 1035 master files
+// without any network access. Delegations to zones not loaded are answered
+// with a referral, CNAMEs are followed through the loaded zones, and
+// wildcards are expanded as in RFC 4592.
+type Zones struct {
+	// soas maps the apex of each zone to its SOA.
+	soas map[string]*dns.SOA
+	// names maps an owner name to its records by type.
+	names map[string]map[uint16][]dns.RR
+	// exists has the owner names and the empty non-terminals above them.
+	exists map[string]bool
+}
+
+// NewZones returns a Zones without any zone.
+func NewZones() *Zones {
+	return &Zones{
+		soas:   make(map[string]*dns.SOA),
+		names:  make(map[string]map[uint16][]dns.RR),
+		exists: make(map[string]bool),
+	}
+}
+
+// LoadZones loads the master files in specs, each a path or origin=path for
+// a file with relative names and no $ORIGIN.
+func LoadZones(specs []string) (*Zones, error) {
+	z := NewZones()
+
+	for _, spec := range specs {
+		origin, path, ok := strings.Cut(spec, "=")
+
+		if !ok {
+			origin, path = ".", spec
+		}
+
+		if err := z.load(dns.Fqdn(origin), path); err != nil {
+			return nil, err
+		}
+	}
+
+	return z, nil
+}
+
+// load adds the records of the master file at path.
+func (z *Zones) load(origin, path string) error {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var rrs []dns.RR
+
+	zp := dns.NewZoneParser(f, origin, path)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		rrs = append(rrs, rr)
+	}
+
+	if err := zp.Err(); err != nil {
+		return err
+	}
+
+	found := false
+
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			z.soas[dns.CanonicalName(soa.Hdr.Name)] = soa
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%s: no SOA record", path)
+	}
+
+	for _, rr := range rrs {
+		if err := z.add(rr); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// add adds rr to its zone.
+func (z *Zones) add(rr dns.RR) error {
+	name := dns.CanonicalName(rr.Header().Name)
+	zone := z.zoneOf(name)
+
+	if zone == "" {
+		return fmt.Errorf("%s is outside of the zones", name)
+	}
+
+	if z.names[name] == nil {
+		z.names[name] = make(map[uint16][]dns.RR)
+	}
+
+	t := rr.Header().Rrtype
+	z.names[name][t] = append(z.names[name][t], rr)
+
+	for cur := name; !z.exists[cur]; {
+		z.exists[cur] = true
+
+		if cur == zone {
+			break
+		}
+
+		cur = parent(cur)
+	}
+
+	return nil
+}
+
+// parent returns the parent of the domain name, or the root for the root.
+func parent(name string) string {
+	if off, end := dns.NextLabel(name, 0); !end {
+		return name[off:]
+	}
+
+	return "."
+}
+
+// zoneOf returns the apex of the closest zone of name, or an empty string.
+func (z *Zones) zoneOf(name string) string {
+	for cur := name; ; cur = parent(cur) {
+		if _, ok := z.soas[cur]; ok {
+			return cur
+		}
+
+		if cur == "." {
+			return ""
+		}
+	}
+}
+
+// cut returns the highest delegation of zone above or at name, or an empty
+// string. A DS query at a delegation is answered by the parent.
+func (z *Zones) cut(zone, name string, qtype uint16) string {
+	found := ""
+
+	for cur := name; cur != zone; cur = parent(cur) {
+		if cur == name && qtype == dns.TypeDS {
+			continue
+		}
+
+		if len(z.names[cur][dns.TypeNS]) > 0 {
+			found = cur
+		}
+	}
+
+	return found
+}
+
+// lookup returns the records of name, synthesized from a wildcard if name
+// does not exist, and whether name exists.
+func (z *Zones) lookup(zone, name string) (map[uint16][]dns.RR, bool) {
+	if z.exists[name] {
+		return z.names[name], true
+	}
+
+	// The wildcard at the closest encloser, see RFC 4592 section 3.3.1.
+	encloser := parent(name)
+
+	for !z.exists[encloser] && encloser != zone {
+		encloser = parent(encloser)
+	}
+
+	wild, ok := z.names["*."+encloser]
+
+	if !ok {
+		return nil, false
+	}
+
+	rrs := make(map[uint16][]dns.RR)
+
+	for t, set := range wild {
+		for _, rr := range set {
+			rr = dns.Copy(rr)
+			rr.Header().Name = name
+			rrs[t] = append(rrs[t], rr)
+		}
+	}
+
+	return rrs, true
+}
+
+// negative returns the SOA of zone with the negative TTL of RFC 2308.
+func (z *Zones) negative(zone string) dns.RR {
+	soa := dns.Copy(z.soas[zone]).(*dns.SOA)
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+
+	return soa
+}
+
+// Resolve answers the query from the zones. A name outside of the zones is
+// REFUSED.
+func (z *Zones) Resolve(name string, qtype uint16) (*Result, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.Response = true
+
+	cur := dns.CanonicalName(dns.Fqdn(name))
+	zone := z.zoneOf(cur)
+
+	if zone == "" {
+		m.Rcode = dns.RcodeRefused
+
+		return &Result{Msg: m, Transport: TransportZone}, nil
+	}
+
+	upstream := zone
+	m.Authoritative = true
+
+	for depth := 0; ; depth++ {
+		if depth > maxCNAME {
+			m.Rcode = dns.RcodeServerFailure
+			break
+		}
+
+		if cut := z.cut(zone, cur, qtype); cut != "" {
+			if depth == 0 {
+				m.Authoritative = false
+			}
+
+			for _, rr := range z.names[cut][dns.TypeNS] {
+				m.Ns = append(m.Ns, rr)
+				m.Extra = append(
+					m.Extra,
+					z.names[dns.CanonicalName(rr.(*dns.NS).Ns)][dns.TypeA]...,
+				)
+				m.Extra = append(
+					m.Extra,
+					z.names[dns.CanonicalName(rr.(*dns.NS).Ns)][dns.TypeAAAA]...,
+				)
+			}
+
+			break
+		}
+
+		rrs, ok := z.lookup(zone, cur)
+
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+			m.Ns = append(m.Ns, z.negative(zone))
+
+			break
+		}
+
+		if len(rrs[qtype]) > 0 {
+			m.Answer = append(m.Answer, rrs[qtype]...)
+			break
+		}
+
+		cnames := rrs[dns.TypeCNAME]
+
+		if len(cnames) == 0 || qtype == dns.TypeCNAME {
+			// NODATA
+			m.Ns = append(m.Ns, z.negative(zone))
+			break
+		}
+
+		m.Answer = append(m.Answer, cnames[0])
+		cur = dns.CanonicalName(cnames[0].(*dns.CNAME).Target)
+
+		if zone = z.zoneOf(cur); zone == "" {
+			// The target is left to the client.
+			break
+		}
+	}
+
+	return &Result{Msg: m, Upstream: upstream, Transport: TransportZone}, nil
+}
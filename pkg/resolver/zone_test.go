@@ -0,0 +1,255 @@
+package resolver_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/resolver"
+)
+
+const exampleZone = `$ORIGIN example.
+$TTL 3600
+@	IN	SOA	ns admin 1 3600 600 86400 300
+	IN	NS	ns
+ns	IN	A	192.0.2.53
+a	60	IN	A	192.0.2.1
+b.c	IN	A	192.0.2.2
+www	IN	CNAME	a
+ext	IN	CNAME	www.elsewhere.
+dangling	IN	CNAME	nx
+other	IN	CNAME	a.other.
+loop1	IN	CNAME	loop2
+loop2	IN	CNAME	loop1
+*.wild	IN	A	192.0.2.3
+sub	IN	NS	ns.sub
+ns.sub	IN	A	192.0.2.54
+`
+
+// otherZone has relative names without $ORIGIN.
+const otherZone = `$TTL 3600
+@	IN	SOA	ns.example. admin.example. 1 3600 600 86400 300
+a	IN	A	192.0.2.4
+`
+
+func writeZones(t *testing.T) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	example := filepath.Join(dir, "example.zone")
+	other := filepath.Join(dir, "other.zone")
+
+	assert.NoError(t, os.WriteFile(example, []byte(exampleZone), 0o644))
+	assert.NoError(t, os.WriteFile(other, []byte(otherZone), 0o644))
+
+	return []string{example, "other=" + other}
+}
+
+func TestZones(t *testing.T) {
+	z, err := resolver.LoadZones(writeZones(t))
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  uint16
+		rcode  int
+		aa     bool
+		answer []string
+		soa    bool
+		ns     []string
+	}{
+		{
+			name:   "answer",
+			qname:  "a.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			aa:     true,
+			answer: []string{"192.0.2.1"},
+		},
+		{
+			name:  "nxdomain",
+			qname: "nx.example",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeNameError,
+			aa:    true,
+			soa:   true,
+		},
+		{
+			name:  "nodata",
+			qname: "a.example",
+			qtype: dns.TypeAAAA,
+			rcode: dns.RcodeSuccess,
+			aa:    true,
+			soa:   true,
+		},
+		{
+			name:  "empty non-terminal",
+			qname: "c.example",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeSuccess,
+			aa:    true,
+			soa:   true,
+		},
+		{
+			name:   "cname",
+			qname:  "www.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			aa:     true,
+			answer: []string{"a.example.", "192.0.2.1"},
+		},
+		{
+			name:   "cname query",
+			qname:  "www.example",
+			qtype:  dns.TypeCNAME,
+			rcode:  dns.RcodeSuccess,
+			aa:     true,
+			answer: []string{"a.example."},
+		},
+		{
+			name:   "cname outside",
+			qname:  "ext.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			aa:     true,
+			answer: []string{"www.elsewhere."},
+		},
+		{
+			name:   "cname to nxdomain",
+			qname:  "dangling.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeNameError,
+			aa:     true,
+			answer: []string{"nx.example."},
+			soa:    true,
+		},
+		{
+			name:   "cname to other zone",
+			qname:  "other.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			aa:     true,
+			answer: []string{"a.other.", "192.0.2.4"},
+		},
+		{
+			name:  "cname loop",
+			qname: "loop1.example",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeServerFailure,
+			aa:    true,
+			answer: []string{
+				"loop2.example.", "loop1.example.", "loop2.example.",
+				"loop1.example.", "loop2.example.", "loop1.example.",
+				"loop2.example.", "loop1.example.", "loop2.example.",
+			},
+		},
+		{
+			name:   "wildcard",
+			qname:  "x.y.wild.example",
+			qtype:  dns.TypeA,
+			rcode:  dns.RcodeSuccess,
+			aa:     true,
+			answer: []string{"192.0.2.3"},
+		},
+		{
+			name:  "delegation",
+			qname: "www.sub.example",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeSuccess,
+			aa:    false,
+			ns:    []string{"ns.sub.example."},
+		},
+		{
+			name:  "refused",
+			qname: "example.com",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeRefused,
+			aa:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := z.Resolve(tt.qname, tt.qtype)
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, tt.rcode, res.Msg.Rcode)
+			assert.Equal(t, tt.aa, res.Msg.Authoritative)
+			assert.Equal(t, resolver.TransportZone, res.Transport)
+
+			var answer []string
+
+			for _, rr := range res.Msg.Answer {
+				switch rr := rr.(type) {
+				case *dns.A:
+					assert.NotContains(t, rr.Hdr.Name, "*")
+					answer = append(answer, rr.A.String())
+				case *dns.CNAME:
+					answer = append(answer, rr.Target)
+				}
+			}
+
+			assert.Equal(t, tt.answer, answer)
+
+			var soa bool
+			var ns []string
+
+			for _, rr := range res.Msg.Ns {
+				switch rr := rr.(type) {
+				case *dns.SOA:
+					soa = true
+					assert.Equal(t, uint32(300), rr.Hdr.Ttl)
+				case *dns.NS:
+					ns = append(ns, rr.Ns)
+				}
+			}
+
+			assert.Equal(t, tt.soa, soa)
+			assert.Equal(t, tt.ns, ns)
+		})
+	}
+}
+
+func TestLoadZonesError(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		zone string
+	}{
+		{
+			name: "no soa",
+			zone: "a.example. 3600 IN A 192.0.2.1\n",
+		},
+		{
+			name: "outside",
+			zone: "example. 3600 IN SOA ns.example. admin.example. 1 3600 600 86400 300\n" +
+				"a.other. 3600 IN A 192.0.2.1\n",
+		},
+		{
+			name: "syntax",
+			zone: "example. 3600 IN SOA ns.example.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".zone")
+			assert.NoError(t, os.WriteFile(path, []byte(tt.zone), 0o644))
+
+			_, err := resolver.LoadZones([]string{path})
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := resolver.LoadZones([]string{filepath.Join(dir, "missing.zone")})
+	assert.Error(t, err)
+}
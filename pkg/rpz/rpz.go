@@ -0,0 +1,545 @@
+// Package rpz reads and writes DNS response policy zones, see
+// draft-vixie-dnsop-dns-rpz.
+package rpz
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+// Actions of the rules of a zone.
+const (
+	NXDomain = "nxdomain"
+	NoData   = "nodata"
+	Passthru = "passthru"
+	Drop     = "drop"
+	TCPOnly  = "tcp-only"
+	// Local answers with the addresses of the rule.
+	Local = "local"
+)
+
+// targets are the CNAME targets of the actions.
+var targets = map[string]string{
+	NXDomain: ".",
+	NoData:   "*.",
+	Passthru: "rpz-passthru.",
+	Drop:     "rpz-drop.",
+	TCPOnly:  "rpz-tcp-only.",
+}
+
+// tag marks the action of an entry in the comment of a block list.
+const tag = "rpz:"
+
+// Rule is a rule of a zone triggered by a query name, or a comment line
+// without a name.
+type Rule struct {
+	// Name is the query name relative to the origin, *.name for a wildcard.
+	Name    string
+	Action  string
+	Addrs   []string
+	Comment string
+}
+
+// Zone is a response policy zone.
+type Zone struct {
+	Origin string
+	Serial uint32
+	Rules  []*Rule
+	// Skipped counts the records that are not query name rules, such as
+	// rpz-ip triggers and CNAME rewrites.
+	Skipped int
+
+	// passthru and wildcards index the names of the passthru rules and the
+	// parents of the wildcard rules.
+	passthru  map[string]bool
+	wildcards map[string]bool
+}
+
+// commentType is the private type of the records standing for the comment
+// and blank lines, which the zone parser drops.
+const commentType = 65534
+
+// commentReader reads a zone with its comment and blank lines replaced by
+// records of commentType holding the line.
+type commentReader struct {
+	r   *bufio.Reader
+	buf []byte
+	err error
+	// depth is the nesting of the parentheses and quoted reports whether a
+	// string is open, as a line in either continues a record.
+	depth  int
+	quoted bool
+	// owned reports whether a record with an owner was read, which the
+	// records of the lines share.
+	owned bool
+}
+
+func (cr *commentReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 && cr.err == nil {
+		var line string
+
+		line, cr.err = cr.r.ReadString('\n')
+
+		if line != "" {
+			cr.buf = append(cr.buf, cr.line(line)...)
+		}
+	}
+
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+
+	if len(cr.buf) == 0 {
+		return n, cr.err
+	}
+
+	return n, nil
+}
+
+// line returns line, or the record standing for it if it is a comment or
+// blank line.
+func (cr *commentReader) line(line string) string {
+	text := strings.TrimSpace(line)
+
+	if cr.depth == 0 && !cr.quoted && (text == "" || text[0] == ';') {
+		owner := ""
+
+		if !cr.owned {
+			owner = "@"
+		}
+
+		return fmt.Sprintf(
+			"%s 0 IN TYPE%d \\# %d %x\n",
+			owner,
+			commentType,
+			len(text),
+			text,
+		)
+	}
+
+	if cr.depth == 0 && !cr.quoted && line[0] != ' ' && line[0] != '\t' &&
+		line[0] != '$' {
+		cr.owned = true
+	}
+
+	escaped := false
+
+	for _, c := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			cr.quoted = !cr.quoted
+		case cr.quoted:
+		case c == ';':
+			return line
+		case c == '(':
+			cr.depth++
+		case c == ')':
+			cr.depth--
+		}
+	}
+
+	return line
+}
+
+// comment returns the comment of a record of commentType, empty for a blank
+// line.
+func comment(rr dns.RR) (string, error) {
+	u, ok := rr.(*dns.RFC3597)
+
+	if !ok {
+		return "", fmt.Errorf("invalid comment record %s", rr)
+	}
+
+	b, err := hex.DecodeString(u.Rdata)
+
+	return strings.TrimPrefix(string(b), ";"), err
+}
+
+// Parse reads a zone in the RFC 1035 format, with origin for the relative
+// names before an SOA record or $ORIGIN. Comment and blank lines are kept as
+// rules without a name.
+func Parse(r io.Reader, origin, file string) (*Zone, error) {
+	z := &Zone{Origin: dns.Fqdn(origin)}
+	rules := make(map[string]*Rule)
+
+	cr := &commentReader{r: bufio.NewReader(r)}
+	zp := dns.NewZoneParser(cr, z.Origin, file)
+
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if rr.Header().Rrtype == commentType {
+			cmt, err := comment(rr)
+
+			if err != nil {
+				return nil, err
+			}
+
+			z.Rules = append(z.Rules, &Rule{Comment: cmt})
+			continue
+		}
+
+		owner := dns.CanonicalName(rr.Header().Name)
+
+		if soa, ok := rr.(*dns.SOA); ok {
+			z.Origin = owner
+			z.Serial = soa.Serial
+			continue
+		}
+
+		if owner == z.Origin && rr.Header().Rrtype == dns.TypeNS {
+			continue
+		}
+
+		name, ok := strings.CutSuffix(owner, "."+z.Origin)
+
+		if !ok || isTrigger(name) {
+			z.Skipped++
+			continue
+		}
+
+		var action, addr string
+
+		switch rr := rr.(type) {
+		case *dns.CNAME:
+			for a, t := range targets {
+				if strings.EqualFold(rr.Target, t) {
+					action = a
+				}
+			}
+		case *dns.A:
+			action, addr = Local, rr.A.String()
+		case *dns.AAAA:
+			action, addr = Local, rr.AAAA.String()
+		}
+
+		if action == "" {
+			z.Skipped++
+			continue
+		}
+
+		rule := rules[name]
+
+		if rule == nil || rule.Action != action {
+			rule = &Rule{Name: name, Action: action}
+			rule.Comment = strings.TrimPrefix(zp.Comment(), ";")
+			rules[name] = rule
+			z.Rules = append(z.Rules, rule)
+		}
+
+		if addr != "" {
+			rule.Addrs = append(rule.Addrs, addr)
+		}
+	}
+
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+
+	return z, nil
+}
+
+// isTrigger reports whether name is a trigger other than a query name.
+func isTrigger(name string) bool {
+	labels := dns.SplitDomainName(name)
+
+	if len(labels) == 0 {
+		return false
+	}
+
+	switch labels[len(labels)-1] {
+	case "rpz-ip", "rpz-nsdname", "rpz-nsip", "rpz-client-ip":
+		return true
+	}
+
+	return false
+}
+
+// ReadSerial returns the serial of the zone file at path, 0 if it does not
+// exist.
+func ReadSerial(path string) (uint32, error) {
+	f, err := os.Open(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+
+	z, err := Parse(f, ".", path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return z.Serial, nil
+}
+
+// NextSerial returns the serial following prev, the date of now as
+// YYYYMMDD00 or prev + 1 if it is not greater.
+func NextSerial(prev uint32, now time.Time) uint32 {
+	y, m, d := now.Date()
+	serial := uint32(((y*100+int(m))*100 + d) * 100)
+
+	if serial <= prev {
+		return prev + 1
+	}
+
+	return serial
+}
+
+// Covers reports whether the zone decides name already, with a wildcard rule
+// or as a passthru exception. The rules are indexed on the first call.
+func (z *Zone) Covers(name string) bool {
+	if z.passthru == nil {
+		z.passthru = make(map[string]bool)
+		z.wildcards = make(map[string]bool)
+
+		for _, r := range z.Rules {
+			if p, ok := strings.CutPrefix(r.Name, "*."); ok {
+				z.wildcards[p] = true
+			} else if r.Action == Passthru {
+				z.passthru[r.Name] = true
+			}
+		}
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if z.passthru[name] {
+		return true
+	}
+
+	for i := strings.IndexByte(name, '.'); i >= 0; {
+		name = name[i+1:]
+
+		if z.wildcards[name] {
+			return true
+		}
+
+		i = strings.IndexByte(name, '.')
+	}
+
+	return false
+}
+
+// Lines returns the rules as the lines of a block list. Wildcards are not
+// names of a block list and are skipped, and passthru exceptions are written
+// as comments. Actions other than NXDOMAIN are kept in the comment.
+func (z *Zone) Lines() []*hosts.Line {
+	var ls []*hosts.Line
+
+	for _, r := range z.Rules {
+		cmt := r.Comment
+
+		switch {
+		case r.Name == "":
+			ls = append(ls, &hosts.Line{Comment: cmt})
+		case strings.HasPrefix(r.Name, "*."):
+		case r.Action == Passthru:
+			ls = append(ls, &hosts.Line{
+				Comment: " " + tag + Passthru + " " + r.Name + cmt,
+			})
+		case r.Action == Local:
+			for _, a := range r.Addrs {
+				ls = append(ls, &hosts.Line{
+					Addr:    a,
+					Names:   []string{r.Name},
+					Comment: cmt,
+				})
+			}
+		default:
+			if r.Action != NXDomain && !strings.Contains(cmt, tag) {
+				cmt += " " + tag + r.Action
+			}
+
+			ls = append(ls, &hosts.Line{Names: []string{r.Name}, Comment: cmt})
+		}
+	}
+
+	return ls
+}
+
+// Writer writes a zone from the lines of a block list.
+type Writer struct {
+	Origin string
+	// NS is the name server of the zone.
+	NS     string
+	Serial uint32
+	TTL    uint32
+	// Action is the action of the names without an address of their own or
+	// an rpz: tag in their comment.
+	Action string
+	// Wildcard adds a rule for the subdomains of each name.
+	Wildcard bool
+
+	w      io.Writer
+	header bool
+}
+
+// NewWriter returns a Writer of the zone origin to w.
+func NewWriter(w io.Writer, origin string) *Writer {
+	return &Writer{
+		Origin: dns.Fqdn(origin),
+		NS:     "localhost.",
+		TTL:    300,
+		Action: NXDomain,
+		w:      w,
+	}
+}
+
+// action returns the action and address of the names of l, blocked with
+// addr if they have no address.
+func (zw *Writer) action(l *hosts.Line, addr string) (string, string) {
+	if _, a, ok := strings.Cut(l.Comment, tag); ok {
+		a, _, _ = strings.Cut(a, " ")
+
+		if _, ok := targets[a]; ok {
+			return a, ""
+		}
+	}
+
+	// A sinkhole address only blocks the names.
+	if a, err := netip.ParseAddr(l.Addr); err == nil &&
+		!a.IsUnspecified() && !a.IsLoopback() {
+		return Local, l.Addr
+	}
+
+	return zw.Action, addr
+}
+
+// Write writes the rules of l, blocked with addr if they have no address,
+// after the SOA and NS records on the first call.
+func (zw *Writer) Write(l *hosts.Line, addr string) error {
+	if !zw.header {
+		if err := zw.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if len(l.Names) == 0 {
+		if l.Comment == "" {
+			_, err := fmt.Fprintln(zw.w)
+
+			return err
+		}
+
+		_, err := fmt.Fprintln(zw.w, ";"+l.Comment)
+
+		return err
+	}
+
+	action, addr := zw.action(l, addr)
+
+	for _, n := range l.Names {
+		owners := []string{n}
+
+		if zw.Wildcard {
+			owners = append(owners, "*."+n)
+		}
+
+		for _, o := range owners {
+			rr, err := zw.rr(dns.Fqdn(o)+zw.Origin, action, addr)
+
+			if err != nil {
+				return err
+			}
+
+			line := rr.String()
+
+			if l.Comment != "" {
+				line += " ;" + l.Comment
+			}
+
+			if _, err := fmt.Fprintln(zw.w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// rr returns the record of the rule of owner.
+func (zw *Writer) rr(owner, action, addr string) (dns.RR, error) {
+	hdr := dns.RR_Header{Name: owner, Class: dns.ClassINET, Ttl: zw.TTL}
+
+	if action != Local {
+		t, ok := targets[action]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown action %q", action)
+		}
+
+		hdr.Rrtype = dns.TypeCNAME
+
+		return &dns.CNAME{Hdr: hdr, Target: t}, nil
+	}
+
+	a, err := netip.ParseAddr(addr)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q", addr)
+	}
+
+	if a.Is4() {
+		hdr.Rrtype = dns.TypeA
+
+		return &dns.A{Hdr: hdr, A: net.IP(a.AsSlice())}, nil
+	}
+
+	hdr.Rrtype = dns.TypeAAAA
+
+	return &dns.AAAA{Hdr: hdr, AAAA: net.IP(a.AsSlice())}, nil
+}
+
+// writeHeader writes the SOA and NS records of the zone.
+func (zw *Writer) writeHeader() error {
+	zw.header = true
+
+	hdr := dns.RR_Header{Name: zw.Origin, Class: dns.ClassINET, Ttl: zw.TTL}
+	ns := dns.Fqdn(zw.NS)
+
+	hdr.Rrtype = dns.TypeSOA
+	soa := &dns.SOA{
+		Hdr:     hdr,
+		Ns:      ns,
+		Mbox:    "hostmaster." + ns,
+		Serial:  zw.Serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  604800,
+		Minttl:  zw.TTL,
+	}
+
+	hdr.Rrtype = dns.TypeNS
+
+	_, err := fmt.Fprintf(zw.w, "%s\n%s\n", soa, &dns.NS{Hdr: hdr, Ns: ns})
+
+	return err
+}
+
+// Close writes the SOA and NS records if no line was written.
+func (zw *Writer) Close() error {
+	if zw.header {
+		return nil
+	}
+
+	return zw.writeHeader()
+}
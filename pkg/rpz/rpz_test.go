@@ -0,0 +1,168 @@
+package rpz_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mys721tx/lpc/pkg/hosts"
+	"github.com/mys721tx/lpc/pkg/rpz"
+)
+
+// zone is a response policy zone with every kind of rule.
+const zone = `; header
+$TTL 300
+@ IN SOA localhost. hostmaster.localhost. (
+	2024010100 ; serial
+	; timers
+	3600 600 604800 300 )
+@ IN NS localhost.
+
+ads.example.com CNAME . ; ads
+*.ads.example.com CNAME .
+empty.example.com CNAME *.
+ok.example.com CNAME rpz-passthru.
+drop.example.com CNAME rpz-drop.
+page.example.com A 192.0.2.1
+page.example.com AAAA 2001:db8::1
+rewrite.example.com CNAME www.example.net.
+32.1.2.0.192.rpz-ip CNAME .
+`
+
+func TestParse(t *testing.T) {
+	z, err := rpz.Parse(strings.NewReader(zone), "rpz.local", "")
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "rpz.local.", z.Origin)
+	assert.Equal(t, uint32(2024010100), z.Serial)
+	assert.Equal(t, 2, z.Skipped)
+	assert.Equal(t, []*rpz.Rule{
+		{Comment: " header"},
+		{},
+		{Name: "ads.example.com", Action: rpz.NXDomain, Comment: " ads"},
+		{Name: "*.ads.example.com", Action: rpz.NXDomain},
+		{Name: "empty.example.com", Action: rpz.NoData},
+		{Name: "ok.example.com", Action: rpz.Passthru},
+		{Name: "drop.example.com", Action: rpz.Drop},
+		{
+			Name:   "page.example.com",
+			Action: rpz.Local,
+			Addrs:  []string{"192.0.2.1", "2001:db8::1"},
+		},
+	}, z.Rules)
+
+	assert.True(t, z.Covers("www.ads.example.com"))
+	assert.True(t, z.Covers("a.www.ads.example.com"))
+	assert.False(t, z.Covers("www.example.com"))
+	assert.True(t, z.Covers("OK.example.com."))
+	assert.False(t, z.Covers("ads.example.com"))
+	assert.False(t, z.Covers("www.drop.example.com"))
+
+	assert.Equal(t, []*hosts.Line{
+		{Comment: " header"},
+		{},
+		{Names: []string{"ads.example.com"}, Comment: " ads"},
+		{Names: []string{"empty.example.com"}, Comment: " rpz:nodata"},
+		{Comment: " rpz:passthru ok.example.com"},
+		{Names: []string{"drop.example.com"}, Comment: " rpz:drop"},
+		{Addr: "192.0.2.1", Names: []string{"page.example.com"}},
+		{Addr: "2001:db8::1", Names: []string{"page.example.com"}},
+	}, z.Lines())
+}
+
+func TestParseError(t *testing.T) {
+	_, err := rpz.Parse(strings.NewReader("a CNAME\n"), "rpz.local", "")
+
+	assert.Error(t, err)
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	zw := rpz.NewWriter(&buf, "rpz.local")
+	zw.Serial = 7
+	zw.Wildcard = true
+
+	lines := []*hosts.Line{
+		{Comment: " ads"},
+		{Addr: "0.0.0.0", Names: []string{"a.com", "b.com"}},
+		{},
+		{Addr: "192.0.2.1", Names: []string{"page.com"}, Comment: " page"},
+		{Names: []string{"drop.com"}, Comment: " rpz:drop"},
+	}
+
+	for _, l := range lines {
+		assert.NoError(t, zw.Write(l, "0.0.0.0"))
+	}
+
+	assert.NoError(t, zw.Close())
+
+	z, err := rpz.Parse(&buf, ".", "")
+
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "rpz.local.", z.Origin)
+	assert.Equal(t, uint32(7), z.Serial)
+	assert.Equal(t, []*rpz.Rule{
+		{Comment: " ads"},
+		{Name: "a.com", Action: rpz.NXDomain},
+		{Name: "*.a.com", Action: rpz.NXDomain},
+		{Name: "b.com", Action: rpz.NXDomain},
+		{Name: "*.b.com", Action: rpz.NXDomain},
+		{},
+		{
+			Name:    "page.com",
+			Action:  rpz.Local,
+			Addrs:   []string{"192.0.2.1"},
+			Comment: " page",
+		},
+		{
+			Name:    "*.page.com",
+			Action:  rpz.Local,
+			Addrs:   []string{"192.0.2.1"},
+			Comment: " page",
+		},
+		{Name: "drop.com", Action: rpz.Drop, Comment: " rpz:drop"},
+		{Name: "*.drop.com", Action: rpz.Drop, Comment: " rpz:drop"},
+	}, z.Rules)
+
+	buf.Reset()
+	zw = rpz.NewWriter(&buf, "rpz.local")
+	zw.Action = "block"
+
+	assert.Error(t, zw.Write(&hosts.Line{Names: []string{"a.com"}}, ""))
+}
+
+func TestSerial(t *testing.T) {
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, uint32(2024030500), rpz.NextSerial(0, now))
+	assert.Equal(t, uint32(2024030500), rpz.NextSerial(2024010107, now))
+	assert.Equal(t, uint32(2024030502), rpz.NextSerial(2024030501, now))
+
+	path := filepath.Join(t.TempDir(), "db.rpz")
+
+	serial, err := rpz.ReadSerial(path)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(0), serial)
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte(zone), 0o644))
+
+	serial, err = rpz.ReadSerial(path)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(2024010100), serial)
+	}
+}
@@ -0,0 +1,122 @@
+// lpc: Leaky Prefix Checker
+// Copyright (C) 2019  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+// plan writes the queries a run would send for the entries of a hosts file
+// without sending them, with their counts and an estimated runtime. It
+// returns the exit status.
+func plan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+
+	resolverFlags(fs)
+
+	fs.StringVar(
+		&pout,
+		"out",
+		"",
+		"path to the output file, default to stdout.",
+	)
+
+	fs.Parse(args)
+
+	fin := openIn(pin)
+	fout := openOut(pout)
+
+	defer func() {
+		if err := fin.Close(); err != nil {
+			log.Panicf("failed to close %q: %v", pin, err)
+		}
+	}()
+
+	defer func() {
+		if err := fout.Close(); err != nil {
+			log.Panicf("failed to close %q: %v", pout, err)
+		}
+	}()
+
+	w := bufio.NewWriter(fout)
+
+	defer func() {
+		if err := w.Flush(); err != nil {
+			log.Panicf("failed to flush %q: %v", pout, err)
+		}
+	}()
+
+	planner := check.NewPlanner(prefix)
+	entries, prefixed := 0, 0
+
+	scn := bufio.NewScanner(fin)
+
+	for scn.Scan() {
+		ip, hns, _ := hosts.ParseLine(scn.Text())
+
+		if ip == "" {
+			continue
+		}
+
+		for _, c := range planner.Line(hns) {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, dns.TypeToString[c.Qtype], c.From)
+
+			if c.Prefixed() {
+				prefixed++
+			} else {
+				entries++
+			}
+		}
+	}
+
+	if err := scn.Err(); err != nil {
+		log.Panicf("failed to read %q: %v", pin, err)
+	}
+
+	n := entries + prefixed
+	per := time.Duration(sleep) * time.Millisecond
+
+	fmt.Fprintf(
+		os.Stderr,
+		"%d queries for %d entries and %d prefixed names, %d special and %d duplicate names skipped\n",
+		n,
+		entries,
+		prefixed,
+		planner.Special,
+		planner.Duplicates,
+	)
+
+	fmt.Fprintf(
+		os.Stderr,
+		"estimated runtime %v at one query every %v, up to %v if every query times out\n",
+		time.Duration(n)*per,
+		per,
+		time.Duration(n)*(per+time.Duration(timeout)*time.Second),
+	)
+
+	return 0
+}
@@ -0,0 +1,129 @@
+// lpc: Leaky Prefix Checker
+// Copyright (C) 2019  Yishen Miao
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mys721tx/lpc/pkg/check"
+	"github.com/mys721tx/lpc/pkg/hosts"
+)
+
+// verify checks that a filtering resolver enforces every entry of a hosts
+// file and its prefixed names. It returns the exit status.
+func verify(args []string) int {
+	var nxdomain bool
+
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+
+	resolverFlags(fs)
+
+	fs.BoolVar(
+		&nxdomain,
+		"nxdomain",
+		false,
+		"treat NXDOMAIN as enforced, default to false",
+	)
+
+	fs.Parse(args)
+
+	fin := openIn(pin)
+
+	defer func() {
+		if err := fin.Close(); err != nil {
+			log.Panicf("failed to close %q: %v", pin, err)
+		}
+	}()
+
+	r, upstreams := newResolver(fs)
+
+	defer printStats(r, upstreams)
+	defer closeResolver()
+
+	sinkholes := newSinkholes()
+
+	planner := check.NewPlanner(prefix)
+	var queue []check.Candidate
+
+	scn := bufio.NewScanner(fin)
+
+	for scn.Scan() {
+		ip, hns, _ := hosts.ParseLine(scn.Text())
+
+		if ip == "" {
+			continue
+		}
+
+		queue = append(queue, planner.Line(hns)...)
+	}
+
+	if err := scn.Err(); err != nil {
+		log.Panicf("failed to read %q: %v", pin, err)
+	}
+
+	failed := 0
+	queried := make(map[string]bool)
+
+	for _, c := range queue {
+		// An entry may also be the prefixed name of another one.
+		if queried[c.Name] {
+			continue
+		}
+
+		queried[c.Name] = true
+
+		res, err := r.Resolve(c.Name, c.Qtype)
+		pause(res)
+
+		var cls check.Class
+
+		if err != nil {
+			cls = check.Error
+		} else {
+			cls = check.Classify(res.Msg, sinkholes)
+		}
+
+		if cls == check.Filtered || (nxdomain && cls == check.NXDomain) {
+			continue
+		}
+
+		failed++
+
+		if err != nil {
+			fmt.Println(c.Name, cls, err)
+		} else {
+			fmt.Println(c.Name, cls)
+		}
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"%d of %d names not enforced\n",
+		failed,
+		len(queried),
+	)
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}